@@ -0,0 +1,140 @@
+package asyncapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+)
+
+// Version is the version of the AsyncAPI specification documents follow.
+const Version = "3.0.0"
+
+// Actions of operations, from the point of view of the service.
+const (
+	ActionSend    = "send"
+	ActionReceive = "receive"
+)
+
+// Document is an AsyncAPI 3.0 document. Only the parts this service needs are
+// modelled.
+type Document struct {
+	AsyncAPI           string               `json:"asyncapi"`
+	Info               Info                 `json:"info"`
+	Servers            map[string]Server    `json:"servers,omitempty"`
+	DefaultContentType string               `json:"defaultContentType,omitempty"`
+	Channels           map[string]Channel   `json:"channels"`
+	Operations         map[string]Operation `json:"operations"`
+	Components         Components           `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Server struct {
+	Host        string `json:"host"`
+	Protocol    string `json:"protocol"`
+	Pathname    string `json:"pathname,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Channel is where messages are exchanged. Channels without an address are
+// only known at runtime, e.g. the URLs webhooks are registered with.
+type Channel struct {
+	Address     string               `json:"address,omitempty"`
+	Title       string               `json:"title,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Servers     []Reference          `json:"servers,omitempty"`
+	Messages    map[string]Reference `json:"messages"`
+}
+
+type Operation struct {
+	Action      string      `json:"action"`
+	Channel     Reference   `json:"channel"`
+	Summary     string      `json:"summary,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Messages    []Reference `json:"messages"`
+}
+
+type Components struct {
+	Messages map[string]Message `json:"messages"`
+}
+
+type Message struct {
+	Name        string  `json:"name,omitempty"`
+	Title       string  `json:"title,omitempty"`
+	Summary     string  `json:"summary,omitempty"`
+	Description string  `json:"description,omitempty"`
+	ContentType string  `json:"contentType,omitempty"`
+	Headers     *Schema `json:"headers,omitempty"`
+	Payload     *Schema `json:"payload"`
+}
+
+// Reference points at another object of the document.
+type Reference struct {
+	Ref string `json:"$ref"`
+}
+
+func ServerRef(name string) Reference {
+	return Reference{Ref: "#/servers/" + name}
+}
+
+func ChannelRef(name string) Reference {
+	return Reference{Ref: "#/channels/" + name}
+}
+
+// ChannelMessageRef points at a message of a channel, as operations must.
+func ChannelMessageRef(channel, message string) Reference {
+	return Reference{Ref: "#/channels/" + channel + "/messages/" + message}
+}
+
+func MessageRef(name string) Reference {
+	return Reference{Ref: "#/components/messages/" + name}
+}
+
+// JSON encodes the document as indented JSON.
+func (d *Document) JSON() ([]byte, error) {
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode asyncapi document: %w", err)
+	}
+	return append(b, '\n'), nil
+}
+
+// YAML encodes the document as YAML with the same key order as JSON.
+func (d *Document) YAML() ([]byte, error) {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode asyncapi document: %w", err)
+	}
+
+	// JSON is YAML, decoding it into a node keeps the key order
+	var node yaml.Node
+	if err := yaml.Unmarshal(b, &node); err != nil {
+		return nil, fmt.Errorf("failed to convert asyncapi document to yaml: %w", err)
+	}
+	blockStyle(&node)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return nil, fmt.Errorf("failed to encode asyncapi document as yaml: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode asyncapi document as yaml: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// blockStyle drops the flow style and quoting carried over from JSON, the
+// encoder quotes where YAML needs it.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
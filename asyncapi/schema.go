@@ -0,0 +1,140 @@
+package asyncapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"github.com/google/uuid"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema is the subset of JSON Schema used to describe message payloads and
+// headers.
+type Schema struct {
+	Type                 any                `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Const                any                `json:"const,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	uuidType       = reflect.TypeOf(uuid.UUID{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	textMarshaler  = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Reflector derives schemas from Go types the way encoding/json encodes them,
+// so the document cannot describe fields the payloads do not have.
+type Reflector struct {
+	enums map[reflect.Type][]any
+}
+
+func NewReflector() *Reflector {
+	return &Reflector{enums: map[reflect.Type][]any{}}
+}
+
+// Enum restricts the values of T, e.g. of a named string type for statuses.
+func Enum[T any](r *Reflector, values ...T) {
+	enum := make([]any, 0, len(values))
+	for _, v := range values {
+		enum = append(enum, v)
+	}
+	r.enums[reflect.TypeOf((*T)(nil)).Elem()] = enum
+}
+
+// Schema describes the JSON encoding of v.
+func (r *Reflector) Schema(v any) *Schema {
+	return r.schema(reflect.TypeOf(v))
+}
+
+func (r *Reflector) schema(t reflect.Type) *Schema {
+	if enum, ok := r.enums[t]; ok {
+		s := r.kindSchema(t)
+		s.Enum = enum
+		return s
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case uuidType:
+		return &Schema{Type: "string", Format: "uuid"}
+	case rawMessageType:
+		return &Schema{}
+	}
+	if t.Kind() != reflect.Pointer && t.Implements(textMarshaler) {
+		return &Schema{Type: "string"}
+	}
+
+	return r.kindSchema(t)
+}
+
+func (r *Reflector) kindSchema(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return r.schema(t.Elem())
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: r.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: r.schema(t.Elem())}
+	case reflect.Struct:
+		s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		r.fields(s, t)
+		return s
+	default:
+		return &Schema{}
+	}
+}
+
+// fields adds the fields of struct t to s, including the promoted fields of
+// embedded structs.
+func (r *Reflector) fields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			r.fields(s, field.Type)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := r.schema(field.Type)
+		omitempty := strings.Contains(opts, "omitempty")
+		if field.Type.Kind() == reflect.Pointer && !omitempty {
+			if typ, ok := property.Type.(string); ok {
+				property.Type = []string{typ, "null"}
+			}
+		}
+
+		s.Properties[name] = property
+		if !omitempty {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
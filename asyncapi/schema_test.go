@@ -0,0 +1,91 @@
+package asyncapi_test
+
+import (
+	"encoding/json"
+	"github.com/astroniumm/go-asyncapi/asyncapi"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type color string
+
+type embedded struct {
+	Note string `json:"note,omitempty"`
+}
+
+type payload struct {
+	embedded
+	ID      uuid.UUID       `json:"id"`
+	Color   color           `json:"color"`
+	Count   int64           `json:"count"`
+	Ratio   float64         `json:"ratio,omitempty"`
+	Tags    []string        `json:"tags"`
+	Labels  map[string]int  `json:"labels,omitempty"`
+	Params  json.RawMessage `json:"params"`
+	At      time.Time       `json:"at"`
+	DoneAt  *time.Time      `json:"done_at"`
+	Error   *string         `json:"error,omitempty"`
+	Hidden  string          `json:"-"`
+	private string          //nolint:unused
+}
+
+func TestReflectorSchema(t *testing.T) {
+	r := asyncapi.NewReflector()
+	asyncapi.Enum(r, color("red"), color("green"))
+
+	s := r.Schema(payload{})
+	require.Equal(t, "object", s.Type)
+	require.Equal(t, []string{"id", "color", "count", "tags", "params", "at", "done_at"}, s.Required)
+	require.Len(t, s.Properties, 11)
+
+	require.Equal(t, &asyncapi.Schema{Type: "string"}, s.Properties["note"])
+	require.Equal(t, &asyncapi.Schema{Type: "string", Format: "uuid"}, s.Properties["id"])
+	require.Equal(t, &asyncapi.Schema{Type: "string", Enum: []any{color("red"), color("green")}}, s.Properties["color"])
+	require.Equal(t, &asyncapi.Schema{Type: "integer"}, s.Properties["count"])
+	require.Equal(t, &asyncapi.Schema{Type: "number"}, s.Properties["ratio"])
+	require.Equal(t, &asyncapi.Schema{Type: "array", Items: &asyncapi.Schema{Type: "string"}}, s.Properties["tags"])
+	require.Equal(t, &asyncapi.Schema{Type: "object", AdditionalProperties: &asyncapi.Schema{Type: "integer"}}, s.Properties["labels"])
+	require.Equal(t, &asyncapi.Schema{}, s.Properties["params"])
+	require.Equal(t, &asyncapi.Schema{Type: "string", Format: "date-time"}, s.Properties["at"])
+	require.Equal(t, &asyncapi.Schema{Type: []string{"string", "null"}, Format: "date-time"}, s.Properties["done_at"])
+	require.Equal(t, &asyncapi.Schema{Type: "string"}, s.Properties["error"])
+}
+
+func TestDocumentYAMLKeepsKeyOrder(t *testing.T) {
+	doc := &asyncapi.Document{
+		AsyncAPI: asyncapi.Version,
+		Info:     asyncapi.Info{Title: "test", Version: "1.0.0"},
+		Channels: map[string]asyncapi.Channel{
+			"events": {Address: "/events", Messages: map[string]asyncapi.Reference{"event": asyncapi.MessageRef("event")}},
+		},
+		Operations: map[string]asyncapi.Operation{},
+		Components: asyncapi.Components{Messages: map[string]asyncapi.Message{
+			"event": {Payload: &asyncapi.Schema{Type: "string", Enum: []any{"true", "1.0"}}},
+		}},
+	}
+
+	b, err := doc.YAML()
+	require.NoError(t, err)
+	require.Equal(t, `asyncapi: 3.0.0
+info:
+  title: test
+  version: 1.0.0
+channels:
+  events:
+    address: /events
+    messages:
+      event:
+        $ref: '#/components/messages/event'
+operations: {}
+components:
+  messages:
+    event:
+      payload:
+        type: string
+        enum:
+        - "true"
+        - "1.0"
+`, string(b))
+}
@@ -2,13 +2,27 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"github.com/astroniumm/go-asyncapi/config"
+	"github.com/astroniumm/go-asyncapi/download"
+	"github.com/astroniumm/go-asyncapi/events"
+	"github.com/astroniumm/go-asyncapi/outbox"
+	"github.com/astroniumm/go-asyncapi/report"
+	"github.com/astroniumm/go-asyncapi/schedule"
 	"github.com/astroniumm/go-asyncapi/server"
+	"github.com/astroniumm/go-asyncapi/storage"
 	"github.com/astroniumm/go-asyncapi/store"
+	"github.com/astroniumm/go-asyncapi/webhook"
+	"github.com/astroniumm/go-asyncapi/worker"
+	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 	"log/slog"
 	"os"
 	"os/signal"
+	"slices"
+	"sync"
 	"syscall"
 )
 
@@ -18,16 +32,39 @@ func main() {
 	}
 }
 
+// Roles select what a process runs, so the API and the report workers can be
+// scaled independently.
+const (
+	// roleAPI serves HTTP requests and streams report events to clients.
+	roleAPI = "api"
+	// roleWorker generates reports and runs the background jobs: webhook
+	// deliveries, schedules, the lease reaper, the janitor and the outbox relay.
+	roleWorker = "worker"
+	// roleAll runs both in one process.
+	roleAll = "all"
+)
+
 func run() error {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 	conf, err := config.New()
 	if err != nil {
-		return nil
+		return err
 	}
 
+	role := flag.String("role", conf.Role, "what this process runs: api, worker or all")
+	flag.Parse()
+	if !slices.Contains([]string{roleAPI, roleWorker, roleAll}, *role) {
+		return fmt.Errorf("unknown role %q, expected one of api, worker or all", *role)
+	}
+	if !slices.Contains(server.DedupPolicies, conf.ReportDedupPolicy) {
+		return fmt.Errorf("unknown report dedup policy %q, expected one of %v", conf.ReportDedupPolicy, server.DedupPolicies)
+	}
+	runAPI := *role == roleAPI || *role == roleAll
+	runWorker := *role == roleWorker || *role == roleAll
+
 	jsonHandler := slog.NewJSONHandler(os.Stdout, nil)
-	logger := slog.New(jsonHandler)
+	logger := slog.New(jsonHandler).With("role", *role)
 
 	db, err := store.NewPostgresDB()
 	if err != nil {
@@ -35,9 +72,113 @@ func run() error {
 	}
 
 	dataStore := store.New(db)
-	jwtManager := server.NewJWTManager(conf)
-	server := server.NewServer(conf, logger, dataStore, jwtManager)
-	if err := server.Run(ctx); err != nil {
+
+	registry := report.NewRegistry()
+	// signups reports list the emails of all users to whoever requests them,
+	// they are only offered by deployments whose API users may see those
+	if conf.ReportSignupsEnabled {
+		if err := registry.Register(report.NewSignupsGenerator(dataStore.Users)); err != nil {
+			return err
+		}
+	}
+
+	blob, err := storage.New(conf)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	start := func(name string, run func(ctx context.Context) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := run(ctx); err != nil {
+				logger.Error(name+" stopped with error", "error", err)
+			}
+		}()
+	}
+
+	listener := events.NewListener(os.Getenv("DB_URL"), logger)
+
+	var apiServer *server.Server
+	if runAPI {
+		jwtManager := server.NewJWTManager(conf)
+		downloads := download.NewSigner(conf)
+		hub := events.NewHub(dataStore.Reports, logger, conf.EventsPollInterval)
+		apiServer = server.NewServer(conf, logger, dataStore, jwtManager, registry, blob, downloads, hub)
+
+		listener.Handle(store.ChannelReportEvents, func(string) {
+			hub.Wake()
+		})
+		listener.Handle(store.ChannelReportProgress, func(payload string) {
+			var progress store.ReportProgress
+			if err := json.Unmarshal([]byte(payload), &progress); err != nil {
+				logger.Error("failed to decode report progress", "error", err)
+				return
+			}
+			hub.PublishProgress(events.Progress{
+				UserID:        progress.UserID,
+				ReportID:      progress.ReportID,
+				Percent:       progress.Percent,
+				Stage:         progress.Stage,
+				RowsProcessed: progress.RowsProcessed,
+				UpdatedAt:     progress.UpdatedAt,
+			})
+		})
+
+		start("report event hub", hub.Run)
+	}
+
+	if runWorker {
+		processor := worker.NewGeneratorProcessor(conf, logger, registry, blob, dataStore.Reports)
+		pool := worker.NewPool(conf, logger, dataStore.Reports, processor)
+		dispatcher := webhook.NewDispatcher(conf, logger, dataStore.Webhooks)
+		scheduler := schedule.NewScheduler(conf, logger, dataStore.Schedules)
+		reaper := worker.NewReaper(conf, logger, dataStore.Reports)
+		janitor := worker.NewJanitor(conf, logger, dataStore.Reports, dataStore.IdempotencyKeys, blob)
+		relay := outbox.NewRelay(conf, logger, dataStore.Outbox, outbox.NewLogPublisher(logger))
+
+		listener.Handle(store.ChannelReportsQueue, func(string) {
+			pool.Wake()
+		})
+		listener.Handle(store.ChannelReportCancelled, func(payload string) {
+			if reportID, err := uuid.Parse(payload); err == nil {
+				pool.CancelRunning(reportID)
+			}
+		})
+		listener.Handle(store.ChannelWebhookDeliveries, func(string) {
+			dispatcher.Wake()
+		})
+		listener.Handle(store.ChannelOutbox, func(string) {
+			relay.Wake()
+		})
+
+		start("report workers", pool.Run)
+		start("webhook dispatcher", dispatcher.Run)
+		start("report scheduler", scheduler.Run)
+		start("report reaper", reaper.Run)
+		start("report janitor", janitor.Run)
+		start("outbox relay", relay.Run)
+	}
+
+	// metrics are kept off the API, which any signed in user can reach
+	if conf.MetricsAddr != "" {
+		start("metrics server", func(ctx context.Context) error {
+			return server.RunMetrics(ctx, conf.MetricsAddr, logger)
+		})
+	}
+
+	start("postgres listener", listener.Run)
+
+	if apiServer == nil {
+		<-ctx.Done()
+		return nil
+	}
+
+	// a server that cannot listen stops the whole process
+	if err := apiServer.Run(ctx); err != nil {
+		cancel()
 		return err
 	}
 	return nil
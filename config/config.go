@@ -1,10 +1,13 @@
 package config
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"fmt"
 	"github.com/caarlos0/env/v11"
 	"github.com/joho/godotenv"
 	log "github.com/sirupsen/logrus"
+	"time"
 )
 
 type Env string
@@ -15,15 +18,73 @@ const (
 )
 
 type Config struct {
-	ServerPort       string `env:"SERVER_PORT"`
-	ServerHost       string `env:"SERVER_HOST"`
-	DatabaseName     string `env:"DB_NAME"`
-	DatabaseHost     string `env:"DB_HOST"`
-	DatabasePort     string `env:"DB_PORT"`
-	DatabaseUser     string `env:"DB_USER"`
-	DatabasePassword string `env:"DB_PASSWORD"`
-	JwtSecret        string `env:"JWT_SECRET"`
-	Env              Env    `env:"ENV" envDefault:"dev"`
+	ServerPort               string                   `env:"SERVER_PORT"`
+	ServerHost               string                   `env:"SERVER_HOST"`
+	DatabaseName             string                   `env:"DB_NAME"`
+	DatabaseHost             string                   `env:"DB_HOST"`
+	DatabasePort             string                   `env:"DB_PORT"`
+	DatabaseUser             string                   `env:"DB_USER"`
+	DatabasePassword         string                   `env:"DB_PASSWORD"`
+	JwtSecret                string                   `env:"JWT_SECRET"`
+	Env                      Env                      `env:"ENV" envDefault:"dev"`
+	Role                     string                   `env:"ROLE" envDefault:"all"`
+	MetricsAddr              string                   `env:"METRICS_ADDR" envDefault:"localhost:9090"`
+	WorkerConcurrency        int                      `env:"WORKER_CONCURRENCY" envDefault:"4"`
+	WorkerPollInterval       time.Duration            `env:"WORKER_POLL_INTERVAL" envDefault:"10s"`
+	WorkerShutdownTimeout    time.Duration            `env:"WORKER_SHUTDOWN_TIMEOUT" envDefault:"30s"`
+	WorkerCancelPollInterval time.Duration            `env:"WORKER_CANCEL_POLL_INTERVAL" envDefault:"30s"`
+	WorkerLeaseDuration      time.Duration            `env:"WORKER_LEASE_DURATION" envDefault:"1m"`
+	WorkerHeartbeatInterval  time.Duration            `env:"WORKER_HEARTBEAT_INTERVAL" envDefault:"20s"`
+	ReaperInterval           time.Duration            `env:"REAPER_INTERVAL" envDefault:"30s"`
+	ReportOutputDir          string                   `env:"REPORT_OUTPUT_DIR" envDefault:"reports"`
+	ReportMaxAttempts        int                      `env:"REPORT_MAX_ATTEMPTS" envDefault:"3"`
+	ReportRetryBackoff       time.Duration            `env:"REPORT_RETRY_BACKOFF" envDefault:"30s"`
+	ReportRetryMaxBackoff    time.Duration            `env:"REPORT_RETRY_MAX_BACKOFF" envDefault:"30m"`
+	ReportMaxAttemptsByType  map[string]int           `env:"REPORT_MAX_ATTEMPTS_BY_TYPE"`
+	ReportRetryBackoffByType map[string]time.Duration `env:"REPORT_RETRY_BACKOFF_BY_TYPE"`
+	ReportSignupsEnabled     bool                     `env:"REPORT_SIGNUPS_ENABLED" envDefault:"false"`
+	StorageDriver            string                   `env:"STORAGE_DRIVER" envDefault:"local"`
+	S3Endpoint               string                   `env:"S3_ENDPOINT"`
+	S3Bucket                 string                   `env:"S3_BUCKET"`
+	S3Region                 string                   `env:"S3_REGION" envDefault:"us-east-1"`
+	S3AccessKeyID            string                   `env:"S3_ACCESS_KEY_ID"`
+	S3SecretAccessKey        string                   `env:"S3_SECRET_ACCESS_KEY"`
+	PublicUrl                string                   `env:"PUBLIC_URL"`
+	DownloadUrlSecret        string                   `env:"DOWNLOAD_URL_SECRET"`
+	DownloadUrlTTL           time.Duration            `env:"DOWNLOAD_URL_TTL" envDefault:"24h"`
+	ShareLinkTTL             time.Duration            `env:"SHARE_LINK_TTL" envDefault:"168h"`
+	EventsPollInterval       time.Duration            `env:"EVENTS_POLL_INTERVAL" envDefault:"10s"`
+	WebhookConcurrency       int                      `env:"WEBHOOK_CONCURRENCY" envDefault:"4"`
+	WebhookPollInterval      time.Duration            `env:"WEBHOOK_POLL_INTERVAL" envDefault:"10s"`
+	WebhookTimeout           time.Duration            `env:"WEBHOOK_TIMEOUT" envDefault:"10s"`
+	WebhookMaxAttempts       int                      `env:"WEBHOOK_MAX_ATTEMPTS" envDefault:"8"`
+	WebhookRetryBackoff      time.Duration            `env:"WEBHOOK_RETRY_BACKOFF" envDefault:"30s"`
+	WebhookRetryMaxBackoff   time.Duration            `env:"WEBHOOK_RETRY_MAX_BACKOFF" envDefault:"1h"`
+	OutboxPollInterval       time.Duration            `env:"OUTBOX_POLL_INTERVAL" envDefault:"5s"`
+	OutboxBatchSize          int                      `env:"OUTBOX_BATCH_SIZE" envDefault:"100"`
+	OutboxLease              time.Duration            `env:"OUTBOX_LEASE" envDefault:"30s"`
+	OutboxRetryBackoff       time.Duration            `env:"OUTBOX_RETRY_BACKOFF" envDefault:"5s"`
+	OutboxRetryMaxBackoff    time.Duration            `env:"OUTBOX_RETRY_MAX_BACKOFF" envDefault:"10m"`
+	OutboxRetention          time.Duration            `env:"OUTBOX_RETENTION" envDefault:"24h"`
+	OutboxCleanupInterval    time.Duration            `env:"OUTBOX_CLEANUP_INTERVAL" envDefault:"10m"`
+	SchedulerInterval        time.Duration            `env:"SCHEDULER_INTERVAL" envDefault:"15s"`
+	SchedulerMisfireGrace    time.Duration            `env:"SCHEDULER_MISFIRE_GRACE" envDefault:"1m"`
+	ReportRetention          time.Duration            `env:"REPORT_RETENTION" envDefault:"720h"`
+	ReportRetentionByType    map[string]time.Duration `env:"REPORT_RETENTION_BY_TYPE"`
+	JanitorInterval          time.Duration            `env:"JANITOR_INTERVAL" envDefault:"1h"`
+	JanitorBatchSize         int                      `env:"JANITOR_BATCH_SIZE" envDefault:"100"`
+	IdempotencyKeyTTL        time.Duration            `env:"IDEMPOTENCY_KEY_TTL" envDefault:"24h"`
+	IdempotencyLockTimeout   time.Duration            `env:"IDEMPOTENCY_LOCK_TIMEOUT" envDefault:"1m"`
+	IdempotencySecret        string                   `env:"IDEMPOTENCY_SECRET"`
+	ReportPriorityWeights    map[string]int           `env:"REPORT_PRIORITY_WEIGHTS" envDefault:"high:8,normal:4,low:1"`
+	ReportFairShareWindow    time.Duration            `env:"REPORT_FAIR_SHARE_WINDOW" envDefault:"10m"`
+	ReportProgressInterval   time.Duration            `env:"REPORT_PROGRESS_INTERVAL" envDefault:"2s"`
+	QuotaConcurrentReports   int64                    `env:"QUOTA_CONCURRENT_REPORTS" envDefault:"10"`
+	QuotaDailyReports        int64                    `env:"QUOTA_DAILY_REPORTS" envDefault:"500"`
+	QuotaRetainedBytes       int64                    `env:"QUOTA_RETAINED_BYTES" envDefault:"0"`
+	QuotaSchedules           int64                    `env:"QUOTA_SCHEDULES" envDefault:"20"`
+	ReportDedupPolicy        string                   `env:"REPORT_DEDUP_POLICY" envDefault:"attach"`
+	ReportDedupMaxAge        time.Duration            `env:"REPORT_DEDUP_MAX_AGE" envDefault:"1h"`
 }
 
 func (c *Config) DatabaseUrl() string {
@@ -41,6 +102,19 @@ func (c *Config) DatabaseUrl() string {
 	)
 }
 
+// Secret returns the configured secret of a feature, or one derived from the
+// JWT secret for purpose when none is configured, so the JWT signing key is
+// never used as the key of unrelated MACs.
+func (c *Config) Secret(configured, purpose string) []byte {
+	if configured != "" {
+		return []byte(configured)
+	}
+
+	mac := hmac.New(sha256.New, []byte(c.JwtSecret))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
 func New() (*Config, error) {
 	err := godotenv.Load()
 	if err != nil {
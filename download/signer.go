@@ -0,0 +1,85 @@
+package download
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/astroniumm/go-asyncapi/config"
+	"github.com/google/uuid"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid download signature")
+	ErrExpired          = errors.New("download link has expired")
+)
+
+// Signer mints and verifies expiring download links for report outputs,
+// so outputs can be fetched without a bearer token.
+type Signer struct {
+	secret  []byte
+	baseURL string
+	ttl     time.Duration
+}
+
+func NewSigner(config *config.Config) *Signer {
+	baseURL := config.PublicUrl
+	if baseURL == "" {
+		baseURL = "http://" + config.ServerHost + ":" + config.ServerPort
+	}
+
+	return &Signer{
+		secret:  config.Secret(config.DownloadUrlSecret, "download"),
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		ttl:     config.DownloadUrlTTL,
+	}
+}
+
+// BaseURL is the public URL the API is reachable at, without a trailing slash.
+func (s *Signer) BaseURL() string {
+	return s.baseURL
+}
+
+// Sign returns a download URL for the report that is valid until the returned time.
+func (s *Signer) Sign(reportID uuid.UUID, now time.Time) (string, time.Time) {
+	expiresAt := now.Add(s.ttl).Truncate(time.Second)
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", s.signature(reportID, expires))
+
+	return s.baseURL + "/reports/" + reportID.String() + "/download?" + query.Encode(), expiresAt
+}
+
+// Verify checks the expires and signature query parameters of a download URL.
+func (s *Signer) Verify(reportID uuid.UUID, expires, signature string, now time.Time) error {
+	expected, err := hex.DecodeString(s.signature(reportID, expires))
+	if err != nil {
+		return err
+	}
+	actual, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, actual) {
+		return ErrInvalidSignature
+	}
+
+	expiresUnix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if !now.Before(time.Unix(expiresUnix, 0)) {
+		return ErrExpired
+	}
+
+	return nil
+}
+
+func (s *Signer) signature(reportID uuid.UUID, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(reportID.String() + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,41 @@
+package download_test
+
+import (
+	"github.com/astroniumm/go-asyncapi/config"
+	"github.com/astroniumm/go-asyncapi/download"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSigner(t *testing.T) {
+	signer := download.NewSigner(&config.Config{
+		JwtSecret:      "mysecret",
+		ServerHost:     "localhost",
+		ServerPort:     "8080",
+		DownloadUrlTTL: time.Hour,
+	})
+
+	now := time.Now()
+	reportID := uuid.New()
+	rawURL, expiresAt := signer.Sign(reportID, now)
+	require.WithinDuration(t, now.Add(time.Hour), expiresAt, time.Second)
+
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+	require.Equal(t, "localhost:8080", u.Host)
+	require.Equal(t, "/reports/"+reportID.String()+"/download", u.Path)
+
+	expires, signature := u.Query().Get("expires"), u.Query().Get("signature")
+	require.NoError(t, signer.Verify(reportID, expires, signature, now))
+
+	require.ErrorIs(t, signer.Verify(reportID, expires, signature, expiresAt), download.ErrExpired)
+	require.ErrorIs(t, signer.Verify(uuid.New(), expires, signature, now), download.ErrInvalidSignature)
+	require.ErrorIs(t, signer.Verify(reportID, expires+"0", signature, now), download.ErrInvalidSignature)
+	require.ErrorIs(t, signer.Verify(reportID, expires, "not-hex", now), download.ErrInvalidSignature)
+
+	other := download.NewSigner(&config.Config{JwtSecret: "other", DownloadUrlTTL: time.Hour})
+	require.ErrorIs(t, other.Verify(reportID, expires, signature, now), download.ErrInvalidSignature)
+}
@@ -0,0 +1,243 @@
+package events
+
+import (
+	"context"
+	"github.com/astroniumm/go-asyncapi/store"
+	"github.com/google/uuid"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	subscriptionBuffer = 64
+	pollBatchSize      = 500
+	// gapTimeout bounds how long a missing event id is waited for. Ids of
+	// transactions that are still in flight become visible out of order, ids
+	// of rolled back transactions never do.
+	gapTimeout = 10 * time.Second
+	// maxTrackedGap avoids tracking every id of a large jump in the sequence
+	maxTrackedGap = 1000
+)
+
+// Source is where the hub reads report events from.
+type Source interface {
+	LatestEventID(ctx context.Context) (int64, error)
+	EventsSince(ctx context.Context, afterID int64, limit int) ([]store.ReportEvent, error)
+}
+
+// Progress is a snapshot of how far a running report has got.
+type Progress struct {
+	UserID        uuid.UUID `json:"-"`
+	ReportID      uuid.UUID `json:"report_id"`
+	Percent       float64   `json:"percent"`
+	Stage         string    `json:"stage,omitempty"`
+	RowsProcessed int64     `json:"rows_processed"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Subscription receives the report events of one user. C is closed when the
+// subscriber falls too far behind, it should then resume from the last event id.
+// Progress updates are best effort and dropped when the subscriber is busy.
+type Subscription struct {
+	C        <-chan store.ReportEvent
+	Progress <-chan Progress
+	ch       chan store.ReportEvent
+	progress chan Progress
+	userID   uuid.UUID
+}
+
+// Hub fans report events out to the subscribers of this process.
+type Hub struct {
+	source   Source
+	logger   *slog.Logger
+	interval time.Duration
+
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[*Subscription]struct{}
+
+	wake chan struct{}
+}
+
+func NewHub(source Source, logger *slog.Logger, interval time.Duration) *Hub {
+	return &Hub{
+		source:      source,
+		logger:      logger,
+		interval:    interval,
+		subscribers: map[uuid.UUID]map[*Subscription]struct{}{},
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+func (h *Hub) Subscribe(userID uuid.UUID) *Subscription {
+	ch := make(chan store.ReportEvent, subscriptionBuffer)
+	progress := make(chan Progress, subscriptionBuffer)
+	sub := &Subscription{C: ch, Progress: progress, ch: ch, progress: progress, userID: userID}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = map[*Subscription]struct{}{}
+	}
+	h.subscribers[userID][sub] = struct{}{}
+
+	return sub
+}
+
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(sub)
+}
+
+func (h *Hub) remove(sub *Subscription) {
+	subs, ok := h.subscribers[sub.userID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+
+	delete(subs, sub)
+	close(sub.ch)
+	if len(subs) == 0 {
+		delete(h.subscribers, sub.userID)
+	}
+}
+
+// Publish delivers the event to the subscribers of its user without blocking.
+func (h *Hub) Publish(event store.ReportEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers[event.UserID] {
+		select {
+		case sub.ch <- event:
+		default:
+			h.logger.Warn("dropping slow report event subscriber", "user_id", event.UserID)
+			h.remove(sub)
+		}
+	}
+}
+
+// PublishProgress delivers the progress update to the subscribers of its user,
+// skipping those that have not consumed earlier updates yet.
+func (h *Hub) PublishProgress(progress Progress) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers[progress.UserID] {
+		select {
+		case sub.progress <- progress:
+		default:
+		}
+	}
+}
+
+// Wake makes Run poll for new events right away instead of waiting for the next tick.
+func (h *Hub) Wake() {
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run polls the source for new events and publishes them until ctx is cancelled.
+func (h *Hub) Run(ctx context.Context) error {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	var cursor *cursor
+	for cursor == nil {
+		lastID, err := h.source.LatestEventID(ctx)
+		if err == nil {
+			cursor = newCursor(lastID)
+			break
+		}
+		if ctx.Err() == nil {
+			h.logger.Error("failed to get latest report event", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-h.wake:
+		}
+
+		after := cursor.from()
+		for {
+			events, err := h.source.EventsSince(ctx, after, pollBatchSize)
+			if err != nil {
+				if ctx.Err() == nil {
+					h.logger.Error("failed to poll report events", "error", err)
+				}
+				break
+			}
+			for _, event := range cursor.advance(events, time.Now()) {
+				h.Publish(event)
+			}
+			if len(events) < pollBatchSize {
+				break
+			}
+			after = events[len(events)-1].ID
+		}
+	}
+}
+
+// cursor tracks the last seen event id and the ids skipped before it, so events
+// committed out of id order are still picked up by later polls.
+type cursor struct {
+	last int64
+	gaps map[int64]time.Time
+}
+
+func newCursor(last int64) *cursor {
+	return &cursor{last: last, gaps: map[int64]time.Time{}}
+}
+
+func (c *cursor) from() int64 {
+	from := c.last
+	for id := range c.gaps {
+		from = min(from, id-1)
+	}
+	return from
+}
+
+// advance returns the events that have not been seen before.
+func (c *cursor) advance(events []store.ReportEvent, now time.Time) []store.ReportEvent {
+	fresh := make([]store.ReportEvent, 0, len(events))
+	for _, event := range events {
+		if event.ID <= c.last {
+			if _, ok := c.gaps[event.ID]; !ok {
+				continue
+			}
+			delete(c.gaps, event.ID)
+		}
+		if event.ID-c.last <= maxTrackedGap {
+			for id := c.last + 1; id < event.ID; id++ {
+				c.gaps[id] = now
+			}
+		}
+		c.last = max(c.last, event.ID)
+		fresh = append(fresh, event)
+	}
+
+	for id, seen := range c.gaps {
+		if now.Sub(seen) > gapTimeout {
+			delete(c.gaps, id)
+		}
+	}
+
+	return fresh
+}
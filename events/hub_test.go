@@ -0,0 +1,112 @@
+package events_test
+
+import (
+	"context"
+	"github.com/astroniumm/go-asyncapi/events"
+	"github.com/astroniumm/go-asyncapi/store"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSource serves the events that have been committed so far, ordered by id.
+type fakeSource struct {
+	mu     sync.Mutex
+	events []store.ReportEvent
+}
+
+func (s *fakeSource) commit(event store.ReportEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+}
+
+func (s *fakeSource) LatestEventID(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (s *fakeSource) EventsSince(ctx context.Context, afterID int64, limit int) ([]store.ReportEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []store.ReportEvent
+	for _, event := range s.events {
+		if event.ID > afterID {
+			events = append(events, event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+func receive(t *testing.T, sub *events.Subscription) store.ReportEvent {
+	select {
+	case event, ok := <-sub.C:
+		require.True(t, ok)
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+		return store.ReportEvent{}
+	}
+}
+
+func TestHub(t *testing.T) {
+	source := &fakeSource{}
+	hub := events.NewHub(source, slog.Default(), time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	alice, bob := uuid.New(), uuid.New()
+	aliceSub := hub.Subscribe(alice)
+	bobSub := hub.Subscribe(bob)
+
+	source.commit(store.ReportEvent{ID: 1, UserID: alice, Status: store.ReportStatusPending})
+	// event 2 is committed after event 3 by a slower transaction
+	source.commit(store.ReportEvent{ID: 3, UserID: alice, Status: store.ReportStatusCompleted})
+	hub.Wake()
+
+	require.Equal(t, int64(1), receive(t, aliceSub).ID)
+	require.Equal(t, int64(3), receive(t, aliceSub).ID)
+
+	source.commit(store.ReportEvent{ID: 2, UserID: bob, Status: store.ReportStatusRunning})
+	hub.Wake()
+
+	require.Equal(t, int64(2), receive(t, bobSub).ID)
+	select {
+	case event := <-aliceSub.C:
+		t.Fatalf("unexpected event for another user: %+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	hub.Unsubscribe(aliceSub)
+	_, ok := <-aliceSub.C
+	require.False(t, ok)
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	hub := events.NewHub(&fakeSource{}, slog.Default(), time.Hour)
+	userID := uuid.New()
+	sub := hub.Subscribe(userID)
+
+	for i := 1; i <= 1000; i++ {
+		hub.Publish(store.ReportEvent{ID: int64(i), UserID: userID})
+	}
+
+	received := 0
+	for range sub.C {
+		received++
+	}
+	require.Less(t, received, 1000)
+
+	// unsubscribing a dropped subscriber is a no-op
+	hub.Unsubscribe(sub)
+}
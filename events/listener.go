@@ -0,0 +1,76 @@
+package events
+
+import (
+	"context"
+	"github.com/lib/pq"
+	"log/slog"
+	"time"
+)
+
+const listenerPingInterval = 90 * time.Second
+
+// Listener receives Postgres notifications on a dedicated connection and
+// dispatches them to the handlers registered for their channel.
+type Listener struct {
+	dsn      string
+	logger   *slog.Logger
+	handlers map[string][]func(payload string)
+}
+
+func NewListener(dsn string, logger *slog.Logger) *Listener {
+	return &Listener{
+		dsn:      dsn,
+		logger:   logger,
+		handlers: map[string][]func(payload string){},
+	}
+}
+
+// Handle registers a handler for notifications on channel. Handlers run on the
+// listener goroutine and must not block. After a reconnect, when notifications
+// may have been missed, every handler is called with an empty payload.
+// Handlers must be registered before Run.
+func (l *Listener) Handle(channel string, handler func(payload string)) {
+	l.handlers[channel] = append(l.handlers[channel], handler)
+}
+
+func (l *Listener) Run(ctx context.Context) error {
+	listener := pq.NewListener(l.dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			l.logger.Error("postgres listener connection problem", "error", err, "event", event)
+		}
+	})
+	defer listener.Close()
+
+	for channel := range l.handlers {
+		if err := listener.Listen(channel); err != nil {
+			return err
+		}
+	}
+
+	ping := time.NewTicker(listenerPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case notification := <-listener.Notify:
+			if notification == nil {
+				// the connection was re-established
+				for _, handlers := range l.handlers {
+					for _, handler := range handlers {
+						handler("")
+					}
+				}
+				continue
+			}
+			for _, handler := range l.handlers[notification.Channel] {
+				handler(notification.Extra)
+			}
+		case <-ping.C:
+			if err := listener.Ping(); err != nil {
+				l.logger.Warn("postgres listener ping failed", "error", err)
+			}
+		}
+	}
+}
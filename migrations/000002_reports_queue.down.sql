@@ -0,0 +1 @@
+DROP INDEX reports_pending_idx;
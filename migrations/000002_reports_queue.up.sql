@@ -0,0 +1,2 @@
+CREATE INDEX reports_pending_idx ON reports (created_at)
+    WHERE started_at IS NULL AND failed_at IS NULL AND completed_at IS NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE reports DROP COLUMN params;
+
+ALTER TABLE reports DROP COLUMN report_type;
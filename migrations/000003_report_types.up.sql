@@ -0,0 +1,4 @@
+ALTER TABLE reports ADD COLUMN report_type VARCHAR NOT NULL DEFAULT 'legacy';
+ALTER TABLE reports ALTER COLUMN report_type DROP DEFAULT;
+
+ALTER TABLE reports ADD COLUMN params JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,7 @@
+DROP INDEX reports_pending_idx;
+CREATE INDEX reports_pending_idx ON reports (created_at)
+    WHERE started_at IS NULL AND failed_at IS NULL AND completed_at IS NULL;
+
+ALTER TABLE reports DROP COLUMN dead_lettered_at;
+ALTER TABLE reports DROP COLUMN next_attempt_at;
+ALTER TABLE reports DROP COLUMN attempts;
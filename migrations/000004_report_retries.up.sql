@@ -0,0 +1,7 @@
+ALTER TABLE reports ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE reports ADD COLUMN next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE reports ADD COLUMN dead_lettered_at TIMESTAMPTZ;
+
+DROP INDEX reports_pending_idx;
+CREATE INDEX reports_pending_idx ON reports (next_attempt_at)
+    WHERE started_at IS NULL AND failed_at IS NULL AND completed_at IS NULL;
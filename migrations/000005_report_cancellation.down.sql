@@ -0,0 +1,7 @@
+DROP INDEX reports_id_idx;
+
+DROP INDEX reports_pending_idx;
+CREATE INDEX reports_pending_idx ON reports (next_attempt_at)
+    WHERE started_at IS NULL AND failed_at IS NULL AND completed_at IS NULL;
+
+ALTER TABLE reports DROP COLUMN cancelled_at;
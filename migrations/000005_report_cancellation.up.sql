@@ -0,0 +1,8 @@
+ALTER TABLE reports ADD COLUMN cancelled_at TIMESTAMPTZ;
+
+DROP INDEX reports_pending_idx;
+CREATE INDEX reports_pending_idx ON reports (next_attempt_at)
+    WHERE started_at IS NULL AND failed_at IS NULL AND completed_at IS NULL AND cancelled_at IS NULL;
+
+-- reports are also looked up by id alone, e.g. by download links and workers
+CREATE INDEX reports_id_idx ON reports (id);
@@ -0,0 +1,3 @@
+DROP INDEX reports_schedule_run_idx;
+ALTER TABLE reports DROP COLUMN schedule_id;
+DROP TABLE report_schedules;
@@ -0,0 +1,20 @@
+CREATE TABLE report_schedules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    cron_expr VARCHAR NOT NULL,
+    timezone VARCHAR NOT NULL,
+    report_type VARCHAR NOT NULL,
+    params JSONB NOT NULL DEFAULT '{}',
+    misfire_policy VARCHAR NOT NULL,
+    next_run_at TIMESTAMPTZ NOT NULL,
+    last_run_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX report_schedules_user_id_idx ON report_schedules (user_id);
+CREATE INDEX report_schedules_next_run_at_idx ON report_schedules (next_run_at);
+
+ALTER TABLE reports ADD COLUMN schedule_id UUID REFERENCES report_schedules(id) ON DELETE SET NULL;
+
+-- a scheduled run is never enqueued twice, even if replicas disagree
+CREATE UNIQUE INDEX reports_schedule_run_idx ON reports (schedule_id, report_time) WHERE schedule_id IS NOT NULL;
@@ -0,0 +1,7 @@
+ALTER TABLE report_schedules DROP COLUMN output_gzip;
+ALTER TABLE report_schedules DROP COLUMN output_format;
+
+ALTER TABLE reports DROP COLUMN output_file_extension;
+ALTER TABLE reports DROP COLUMN output_content_type;
+ALTER TABLE reports DROP COLUMN output_gzip;
+ALTER TABLE reports DROP COLUMN output_format;
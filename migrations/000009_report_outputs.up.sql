@@ -0,0 +1,11 @@
+ALTER TABLE reports ADD COLUMN output_format VARCHAR NOT NULL DEFAULT 'csv';
+ALTER TABLE reports ADD COLUMN output_gzip BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE reports ADD COLUMN output_content_type VARCHAR;
+ALTER TABLE reports ADD COLUMN output_file_extension VARCHAR;
+
+-- outputs written so far are uncompressed CSV, except for legacy reports
+UPDATE reports SET output_content_type = 'text/csv; charset=utf-8', output_file_extension = '.csv'
+WHERE output_file_path IS NOT NULL AND report_type <> 'legacy';
+
+ALTER TABLE report_schedules ADD COLUMN output_format VARCHAR NOT NULL DEFAULT 'csv';
+ALTER TABLE report_schedules ADD COLUMN output_gzip BOOLEAN NOT NULL DEFAULT false;
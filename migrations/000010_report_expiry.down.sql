@@ -0,0 +1,2 @@
+DROP INDEX reports_outputs_idx;
+ALTER TABLE reports DROP COLUMN expired_at;
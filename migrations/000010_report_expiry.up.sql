@@ -0,0 +1,4 @@
+ALTER TABLE reports ADD COLUMN expired_at TIMESTAMPTZ;
+
+CREATE INDEX reports_outputs_idx ON reports (COALESCE(completed_at, created_at))
+    WHERE output_file_path IS NOT NULL AND expired_at IS NULL;
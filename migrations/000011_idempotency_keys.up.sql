@@ -0,0 +1,14 @@
+CREATE TABLE idempotency_keys (
+    scope VARCHAR NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    request_hash VARCHAR NOT NULL,
+    response_status INTEGER,
+    response_content_type VARCHAR,
+    response_body BYTEA,
+    locked_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX idempotency_keys_created_at_idx ON idempotency_keys (created_at);
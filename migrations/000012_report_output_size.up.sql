@@ -0,0 +1 @@
+ALTER TABLE reports ADD COLUMN output_size BIGINT;
@@ -0,0 +1,9 @@
+ALTER TABLE reports ADD COLUMN priority VARCHAR(16) NOT NULL DEFAULT 'normal';
+
+-- the queue is picked per priority and user, see ReportsStore.QueueCandidates
+DROP INDEX reports_pending_idx;
+CREATE INDEX reports_pending_idx ON reports (priority, user_id, next_attempt_at, created_at)
+    WHERE started_at IS NULL AND failed_at IS NULL AND completed_at IS NULL AND cancelled_at IS NULL;
+
+-- recent claims decide whose turn it is
+CREATE INDEX reports_started_at_idx ON reports (started_at) WHERE started_at IS NOT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE reports DROP COLUMN progress_updated_at;
+ALTER TABLE reports DROP COLUMN progress_rows;
+ALTER TABLE reports DROP COLUMN progress_stage;
+ALTER TABLE reports DROP COLUMN progress_percent;
@@ -0,0 +1,4 @@
+ALTER TABLE reports ADD COLUMN progress_percent DOUBLE PRECISION;
+ALTER TABLE reports ADD COLUMN progress_stage VARCHAR(100);
+ALTER TABLE reports ADD COLUMN progress_rows BIGINT;
+ALTER TABLE reports ADD COLUMN progress_updated_at TIMESTAMPTZ;
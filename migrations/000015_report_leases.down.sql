@@ -0,0 +1,3 @@
+DROP INDEX reports_lease_idx;
+ALTER TABLE reports DROP COLUMN lease_expires_at;
+ALTER TABLE reports DROP COLUMN lease_owner;
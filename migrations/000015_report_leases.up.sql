@@ -0,0 +1,9 @@
+ALTER TABLE reports ADD COLUMN lease_owner VARCHAR;
+ALTER TABLE reports ADD COLUMN lease_expires_at TIMESTAMPTZ;
+
+-- reports started before leases existed are recovered by the reaper
+UPDATE reports SET lease_expires_at = CURRENT_TIMESTAMP
+WHERE started_at IS NOT NULL AND completed_at IS NULL AND failed_at IS NULL AND cancelled_at IS NULL;
+
+CREATE INDEX reports_lease_idx ON reports (lease_expires_at)
+    WHERE started_at IS NOT NULL AND completed_at IS NULL AND failed_at IS NULL AND cancelled_at IS NULL;
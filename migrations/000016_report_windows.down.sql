@@ -0,0 +1,16 @@
+ALTER TABLE report_schedules DROP COLUMN window_preset;
+
+ALTER TABLE reports ADD COLUMN report_time VARCHAR;
+UPDATE reports SET report_time = to_char(COALESCE(scheduled_at, window_start, created_at) AT TIME ZONE 'UTC',
+    'YYYY-MM-DD"T"HH24:MI:SS"Z"');
+ALTER TABLE reports ALTER COLUMN report_time SET NOT NULL;
+
+DROP INDEX reports_schedule_run_idx;
+CREATE UNIQUE INDEX reports_schedule_run_idx ON reports (schedule_id, report_time) WHERE schedule_id IS NOT NULL;
+
+ALTER TABLE reports DROP CONSTRAINT reports_window_check;
+ALTER TABLE reports DROP COLUMN scheduled_at;
+ALTER TABLE reports DROP COLUMN window_preset;
+ALTER TABLE reports DROP COLUMN window_timezone;
+ALTER TABLE reports DROP COLUMN window_end;
+ALTER TABLE reports DROP COLUMN window_start;
@@ -0,0 +1,39 @@
+ALTER TABLE reports ADD COLUMN window_start TIMESTAMPTZ;
+ALTER TABLE reports ADD COLUMN window_end TIMESTAMPTZ;
+ALTER TABLE reports ADD COLUMN window_timezone VARCHAR NOT NULL DEFAULT 'UTC';
+ALTER TABLE reports ADD COLUMN window_preset VARCHAR(32);
+ALTER TABLE reports ADD COLUMN scheduled_at TIMESTAMPTZ;
+
+-- values without an offset are read as UTC, whatever the time zone of the session
+CREATE FUNCTION pg_temp.try_timestamptz(value TEXT) RETURNS TIMESTAMPTZ AS $$
+BEGIN
+    IF value ~ '\d{2}:\d{2}(:\d{2}(\.\d+)?)?\s*([Zz]|[+-]\d{2}(:?\d{2})?)$' THEN
+        RETURN value::TIMESTAMPTZ;
+    END IF;
+    RETURN value::TIMESTAMP AT TIME ZONE 'UTC';
+EXCEPTION WHEN others THEN
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- report_time was free-form: timestamps become the UTC day containing them,
+-- anything else falls back to the day the report was created
+ALTER TABLE reports ADD COLUMN legacy_time TIMESTAMPTZ;
+UPDATE reports SET legacy_time = COALESCE(
+    CASE WHEN report_time ~ '^\d{4}-\d{2}-\d{2}' THEN pg_temp.try_timestamptz(report_time) END, created_at);
+UPDATE reports SET window_start = date_trunc('day', legacy_time AT TIME ZONE 'UTC') AT TIME ZONE 'UTC';
+UPDATE reports SET window_end = window_start + INTERVAL '1 day';
+-- scheduled runs keep their instant, it identifies the run
+UPDATE reports SET scheduled_at = legacy_time WHERE schedule_id IS NOT NULL;
+ALTER TABLE reports DROP COLUMN legacy_time;
+
+-- presets are resolved when the report runs
+ALTER TABLE reports ADD CONSTRAINT reports_window_check CHECK (
+    (window_start IS NOT NULL AND window_end IS NOT NULL) OR window_preset IS NOT NULL);
+
+DROP INDEX reports_schedule_run_idx;
+CREATE UNIQUE INDEX reports_schedule_run_idx ON reports (schedule_id, scheduled_at) WHERE schedule_id IS NOT NULL;
+
+ALTER TABLE reports DROP COLUMN report_time;
+
+ALTER TABLE report_schedules ADD COLUMN window_preset VARCHAR(32) NOT NULL DEFAULT 'last_24_hours';
@@ -0,0 +1,2 @@
+DROP TABLE report_share_links;
+DROP TABLE report_shares;
@@ -0,0 +1,25 @@
+CREATE TABLE report_shares (
+    owner_id UUID NOT NULL,
+    report_id UUID NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (report_id, user_id),
+    FOREIGN KEY (owner_id, report_id) REFERENCES reports(user_id, id) ON DELETE CASCADE
+);
+
+CREATE INDEX report_shares_user_id_idx ON report_shares (user_id);
+
+CREATE TABLE report_share_links (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    owner_id UUID NOT NULL,
+    report_id UUID NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE, -- sha256 of the token, hex encoded
+    expires_at TIMESTAMPTZ NOT NULL,
+    max_downloads INTEGER,
+    downloads INTEGER NOT NULL DEFAULT 0,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (owner_id, report_id) REFERENCES reports(user_id, id) ON DELETE CASCADE
+);
+
+CREATE INDEX report_share_links_report_idx ON report_share_links (owner_id, report_id);
@@ -0,0 +1,3 @@
+DROP INDEX reports_fingerprint_idx;
+
+ALTER TABLE reports DROP COLUMN fingerprint;
@@ -0,0 +1,3 @@
+ALTER TABLE reports ADD COLUMN fingerprint VARCHAR(64); -- sha256 of type, params, window and output options, hex encoded
+
+CREATE INDEX reports_fingerprint_idx ON reports (user_id, fingerprint, created_at DESC) WHERE fingerprint IS NOT NULL;
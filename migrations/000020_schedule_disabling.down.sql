@@ -0,0 +1,5 @@
+DROP INDEX report_schedules_next_run_at_idx;
+CREATE INDEX report_schedules_next_run_at_idx ON report_schedules (next_run_at);
+
+ALTER TABLE report_schedules DROP COLUMN disabled_reason;
+ALTER TABLE report_schedules DROP COLUMN disabled_at;
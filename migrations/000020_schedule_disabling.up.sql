@@ -0,0 +1,5 @@
+ALTER TABLE report_schedules ADD COLUMN disabled_at TIMESTAMPTZ;
+ALTER TABLE report_schedules ADD COLUMN disabled_reason VARCHAR;
+
+DROP INDEX report_schedules_next_run_at_idx;
+CREATE INDEX report_schedules_next_run_at_idx ON report_schedules (next_run_at) WHERE disabled_at IS NULL;
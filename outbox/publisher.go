@@ -0,0 +1,37 @@
+package outbox
+
+import (
+	"context"
+	"github.com/astroniumm/go-asyncapi/store"
+	"log/slog"
+)
+
+// Publisher hands outbox messages to the outside world, e.g. a message broker.
+// A message counts as published once Publish returns nil. Messages may be
+// published more than once, so consumers should deduplicate by message id.
+type Publisher interface {
+	Publish(ctx context.Context, msg *store.OutboxMessage) error
+}
+
+type PublisherFunc func(ctx context.Context, msg *store.OutboxMessage) error
+
+func (f PublisherFunc) Publish(ctx context.Context, msg *store.OutboxMessage) error {
+	return f(ctx, msg)
+}
+
+// LogPublisher writes messages to the log. It stands in until the service is
+// connected to a broker. Payloads carry personal data such as email addresses,
+// so only the envelope of a message is logged.
+type LogPublisher struct {
+	logger *slog.Logger
+}
+
+func NewLogPublisher(logger *slog.Logger) *LogPublisher {
+	return &LogPublisher{logger: logger}
+}
+
+func (p *LogPublisher) Publish(_ context.Context, msg *store.OutboxMessage) error {
+	p.logger.Info("domain event published", "message_id", msg.ID, "aggregate_type", msg.AggregateType,
+		"aggregate_id", msg.AggregateID, "event_type", msg.EventType, "payload_bytes", len(msg.Payload))
+	return nil
+}
@@ -0,0 +1,182 @@
+package outbox
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"github.com/astroniumm/go-asyncapi/config"
+	"github.com/astroniumm/go-asyncapi/retry"
+	"github.com/astroniumm/go-asyncapi/store"
+	"log/slog"
+	"time"
+)
+
+// relayMetrics are published under "outbox_relay" in /debug/vars.
+var relayMetrics = expvar.NewMap("outbox_relay")
+
+// Messages is the outbox the relay works off.
+type Messages interface {
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]store.OutboxMessage, error)
+	MarkPublished(ctx context.Context, id int64) error
+	Retry(ctx context.Context, id int64, lastError string, nextAttemptAt time.Time) error
+	DeletePublished(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+// Relay publishes outbox messages at least once and in order per aggregate.
+// Failed messages are retried with backoff for as long as it takes, holding
+// back the later messages of their aggregate. Published messages are deleted
+// after OutboxRetention.
+type Relay struct {
+	config    *config.Config
+	logger    *slog.Logger
+	messages  Messages
+	publisher Publisher
+	policy    retry.Policy
+	wake      chan struct{}
+}
+
+func NewRelay(config *config.Config, logger *slog.Logger, messages Messages, publisher Publisher) *Relay {
+	return &Relay{
+		config:    config,
+		logger:    logger,
+		messages:  messages,
+		publisher: publisher,
+		policy: retry.Policy{
+			Backoff:    config.OutboxRetryBackoff,
+			MaxBackoff: config.OutboxRetryMaxBackoff,
+		},
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// Wake makes the relay look for new messages right away.
+func (r *Relay) Wake() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run publishes due messages until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) error {
+	cleanup := time.NewTicker(r.config.OutboxCleanupInterval)
+	defer cleanup.Stop()
+
+	for {
+		published, err := r.RelayBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.logger.Error("failed to relay outbox messages", "error", err)
+		}
+		// a batch holds one message per aggregate, the next messages of the
+		// aggregates just published are likely due already
+		if err == nil && published > 0 {
+			if ctx.Err() != nil {
+				return nil
+			}
+			// a steady stream of messages must not hold off the cleanup
+			select {
+			case <-cleanup.C:
+				r.cleanup(ctx)
+			default:
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-cleanup.C:
+			r.cleanup(ctx)
+		case <-r.wake:
+		case <-time.After(r.config.OutboxPollInterval):
+		}
+	}
+}
+
+// RelayBatch publishes one batch of due messages and returns how many were
+// published. At most one message per aggregate is in a batch, so a failure never
+// holds back another aggregate.
+func (r *Relay) RelayBatch(ctx context.Context) (int, error) {
+	messages, err := r.messages.Claim(ctx, max(r.config.OutboxBatchSize, 1), r.config.OutboxLease)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for i := range messages {
+		if ctx.Err() != nil {
+			// unpublished messages are due again once their lease runs out
+			break
+		}
+		if r.publish(ctx, &messages[i]) {
+			published++
+		}
+	}
+
+	return published, nil
+}
+
+// publish reports whether msg was published and recorded as such.
+func (r *Relay) publish(ctx context.Context, msg *store.OutboxMessage) bool {
+	logger := r.logger.With("message_id", msg.ID, "event_type", msg.EventType, "aggregate_id", msg.AggregateID)
+
+	err := r.publishSafely(ctx, msg)
+
+	recordCtx, cancelRecord := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancelRecord()
+
+	if err == nil {
+		if err := r.messages.MarkPublished(recordCtx, msg.ID); err != nil {
+			// the message is published again once its lease runs out
+			logger.Error("failed to record outbox message publication", "error", err)
+			return false
+		}
+		relayMetrics.Add("published", 1)
+		return true
+	}
+
+	relayMetrics.Add("failed", 1)
+	nextAttemptAt := time.Now().Add(r.policy.Delay(msg.Attempts))
+	if err := r.messages.Retry(recordCtx, msg.ID, err.Error(), nextAttemptAt); err != nil {
+		logger.Error("failed to schedule outbox message retry", "error", err)
+		return false
+	}
+	logger.Warn("outbox message could not be published, retry scheduled", "error", err, "attempt", msg.Attempts, "next_attempt_at", nextAttemptAt)
+	return false
+}
+
+func (r *Relay) publishSafely(ctx context.Context, msg *store.OutboxMessage) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("outbox publisher panicked: %v", p)
+		}
+	}()
+
+	return r.publisher.Publish(ctx, msg)
+}
+
+// cleanup deletes messages published longer than OutboxRetention ago.
+func (r *Relay) cleanup(ctx context.Context) {
+	before := time.Now().Add(-r.config.OutboxRetention)
+	batchSize := max(r.config.OutboxBatchSize, 1)
+
+	var total int64
+	for ctx.Err() == nil {
+		deleted, err := r.messages.DeletePublished(ctx, before, batchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				r.logger.Error("failed to delete published outbox messages", "error", err)
+			}
+			break
+		}
+		total += deleted
+		if deleted < int64(batchSize) {
+			break
+		}
+	}
+
+	relayMetrics.Add("deleted", total)
+	if total > 0 {
+		r.logger.Info("published outbox messages deleted", "count", total)
+	}
+}
@@ -0,0 +1,197 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"github.com/astroniumm/go-asyncapi/config"
+	"github.com/astroniumm/go-asyncapi/outbox"
+	"github.com/astroniumm/go-asyncapi/store"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type retry struct {
+	lastError     string
+	nextAttemptAt time.Time
+}
+
+// fakeMessages hands out a fixed batch and records the outcomes reported by the relay.
+type fakeMessages struct {
+	mu        sync.Mutex
+	batch     []store.OutboxMessage
+	limit     int
+	published []int64
+	retries   map[int64]retry
+}
+
+func (f *fakeMessages) Claim(_ context.Context, limit int, _ time.Duration) ([]store.OutboxMessage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.limit = limit
+	return f.batch, nil
+}
+
+func (f *fakeMessages) MarkPublished(_ context.Context, id int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.published = append(f.published, id)
+	return nil
+}
+
+func (f *fakeMessages) Retry(_ context.Context, id int64, lastError string, nextAttemptAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.retries == nil {
+		f.retries = map[int64]retry{}
+	}
+	f.retries[id] = retry{lastError: lastError, nextAttemptAt: nextAttemptAt}
+	return nil
+}
+
+func (f *fakeMessages) DeletePublished(context.Context, time.Time, int) (int64, error) {
+	panic("not used")
+}
+
+func testRelay(messages outbox.Messages, publisher outbox.Publisher) *outbox.Relay {
+	return outbox.NewRelay(&config.Config{
+		OutboxBatchSize:       10,
+		OutboxLease:           time.Minute,
+		OutboxRetryBackoff:    time.Second,
+		OutboxRetryMaxBackoff: time.Minute,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)), messages, publisher)
+}
+
+func TestRelayBatchPublishesInOrder(t *testing.T) {
+	messages := &fakeMessages{batch: []store.OutboxMessage{
+		{ID: 1, AggregateID: uuid.New(), EventType: store.OutboxEventUserCreated, Attempts: 1},
+		{ID: 2, AggregateID: uuid.New(), EventType: store.ReportOutboxEvent(store.ReportStatusPending), Attempts: 1},
+		{ID: 5, AggregateID: uuid.New(), EventType: store.ReportOutboxEvent(store.ReportStatusCompleted), Attempts: 1},
+	}}
+
+	var order []int64
+	relay := testRelay(messages, outbox.PublisherFunc(func(_ context.Context, msg *store.OutboxMessage) error {
+		order = append(order, msg.ID)
+		return nil
+	}))
+
+	published, err := relay.RelayBatch(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 3, published)
+	require.Equal(t, 10, messages.limit)
+	require.Equal(t, []int64{1, 2, 5}, order)
+	require.Equal(t, []int64{1, 2, 5}, messages.published)
+	require.Empty(t, messages.retries)
+}
+
+func TestRelayBatchRetriesFailedMessages(t *testing.T) {
+	messages := &fakeMessages{batch: []store.OutboxMessage{
+		{ID: 1, AggregateID: uuid.New(), Attempts: 3},
+		{ID: 2, AggregateID: uuid.New(), Attempts: 1},
+		{ID: 3, AggregateID: uuid.New(), Attempts: 1},
+	}}
+
+	relay := testRelay(messages, outbox.PublisherFunc(func(_ context.Context, msg *store.OutboxMessage) error {
+		switch msg.ID {
+		case 1:
+			return errors.New("broker unavailable")
+		case 2:
+			panic("boom")
+		}
+		return nil
+	}))
+
+	before := time.Now()
+	published, err := relay.RelayBatch(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, published)
+
+	require.Equal(t, []int64{3}, messages.published)
+	require.Len(t, messages.retries, 2)
+
+	require.Equal(t, "broker unavailable", messages.retries[1].lastError)
+	// the third attempt backs off for four times the base delay
+	require.WithinDuration(t, before.Add(4*time.Second), messages.retries[1].nextAttemptAt, time.Second)
+
+	require.Contains(t, messages.retries[2].lastError, "panicked")
+	require.WithinDuration(t, before.Add(time.Second), messages.retries[2].nextAttemptAt, time.Second)
+}
+
+func TestRelayBatchStopsOnShutdown(t *testing.T) {
+	messages := &fakeMessages{batch: []store.OutboxMessage{{ID: 1}, {ID: 2}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	relay := testRelay(messages, outbox.PublisherFunc(func(context.Context, *store.OutboxMessage) error {
+		cancel()
+		return nil
+	}))
+
+	_, err := relay.RelayBatch(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []int64{1}, messages.published)
+}
+
+func TestLogPublisherOmitsPayloads(t *testing.T) {
+	var logs strings.Builder
+	publisher := outbox.NewLogPublisher(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	err := publisher.Publish(context.Background(), &store.OutboxMessage{
+		ID: 1, AggregateType: store.OutboxAggregateUser, AggregateID: uuid.New(), EventType: store.OutboxEventUserCreated,
+		Payload: []byte(`{"email":"jane@example.com"}`),
+	})
+	require.NoError(t, err)
+	require.Contains(t, logs.String(), store.OutboxEventUserCreated)
+	require.NotContains(t, logs.String(), "jane@example.com")
+}
+
+// streamingMessages always has another message due. Deleting published
+// messages cancels the relay.
+type streamingMessages struct {
+	mu      sync.Mutex
+	next    int64
+	cleaned context.CancelFunc
+}
+
+func (s *streamingMessages) Claim(context.Context, int, time.Duration) ([]store.OutboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next++
+	return []store.OutboxMessage{{ID: s.next, AggregateID: uuid.New()}}, nil
+}
+
+func (s *streamingMessages) MarkPublished(context.Context, int64) error { return nil }
+
+func (s *streamingMessages) Retry(context.Context, int64, string, time.Time) error { return nil }
+
+func (s *streamingMessages) DeletePublished(context.Context, time.Time, int) (int64, error) {
+	s.cleaned()
+	return 0, nil
+}
+
+func TestRelayCleansUpUnderLoad(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	messages := &streamingMessages{cleaned: cancel}
+	relay := outbox.NewRelay(&config.Config{
+		OutboxBatchSize:       10,
+		OutboxPollInterval:    time.Hour,
+		OutboxCleanupInterval: 10 * time.Millisecond,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)), messages, outbox.PublisherFunc(func(context.Context, *store.OutboxMessage) error {
+		return nil
+	}))
+
+	done := make(chan error, 1)
+	go func() { done <- relay.Run(ctx) }()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("published messages were not cleaned up while messages kept coming")
+	}
+}
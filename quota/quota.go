@@ -0,0 +1,91 @@
+package quota
+
+import (
+	"fmt"
+	"github.com/astroniumm/go-asyncapi/config"
+	"github.com/astroniumm/go-asyncapi/store"
+	"time"
+)
+
+// Names of the limits, as reported to clients.
+const (
+	LimitConcurrentReports = "concurrent_reports"
+	LimitDailyReports      = "daily_reports"
+	LimitRetainedBytes     = "retained_bytes"
+	LimitSchedules         = "schedules"
+)
+
+// Limits bound what a single user may submit. A zero limit is not enforced.
+type Limits struct {
+	// MaxConcurrentReports bounds the reports that are pending or running.
+	MaxConcurrentReports int64
+	// MaxDailyReports bounds the reports submitted since midnight UTC.
+	MaxDailyReports int64
+	// MaxRetainedBytes bounds the size of the outputs that have not expired yet.
+	MaxRetainedBytes int64
+	// MaxSchedules bounds the report schedules of a user.
+	MaxSchedules int64
+}
+
+func FromConfig(config *config.Config) Limits {
+	return Limits{
+		MaxConcurrentReports: config.QuotaConcurrentReports,
+		MaxDailyReports:      config.QuotaDailyReports,
+		MaxRetainedBytes:     config.QuotaRetainedBytes,
+		MaxSchedules:         config.QuotaSchedules,
+	}
+}
+
+// ExceededError tells which limit rejected a submission.
+type ExceededError struct {
+	Limit string
+	Max   int64
+	Used  int64
+}
+
+func (e *ExceededError) Error() string {
+	switch e.Limit {
+	case LimitConcurrentReports:
+		return fmt.Sprintf("quota exceeded: %d of %d reports are already pending or running", e.Used, e.Max)
+	case LimitDailyReports:
+		return fmt.Sprintf("quota exceeded: %d of %d reports were already submitted today", e.Used, e.Max)
+	case LimitSchedules:
+		return fmt.Sprintf("quota exceeded: %d of %d report schedules already exist", e.Used, e.Max)
+	default:
+		return fmt.Sprintf("quota exceeded: report outputs already take %d of %d bytes", e.Used, e.Max)
+	}
+}
+
+// Admit returns an *ExceededError when one more report would go over a limit.
+// Retained bytes are only known once a report completes, so that limit rejects
+// submissions once it has been reached.
+func (l Limits) Admit(usage *store.ReportUsage) error {
+	switch {
+	case l.MaxConcurrentReports > 0 && usage.ConcurrentReports >= l.MaxConcurrentReports:
+		return &ExceededError{Limit: LimitConcurrentReports, Max: l.MaxConcurrentReports, Used: usage.ConcurrentReports}
+	case l.MaxDailyReports > 0 && usage.DailyReports >= l.MaxDailyReports:
+		return &ExceededError{Limit: LimitDailyReports, Max: l.MaxDailyReports, Used: usage.DailyReports}
+	case l.MaxRetainedBytes > 0 && usage.RetainedBytes >= l.MaxRetainedBytes:
+		return &ExceededError{Limit: LimitRetainedBytes, Max: l.MaxRetainedBytes, Used: usage.RetainedBytes}
+	}
+	return nil
+}
+
+// AdmitSchedule returns an *ExceededError when a user that has schedules
+// report schedules may not create another one.
+func (l Limits) AdmitSchedule(schedules int64) error {
+	if l.MaxSchedules > 0 && schedules >= l.MaxSchedules {
+		return &ExceededError{Limit: LimitSchedules, Max: l.MaxSchedules, Used: schedules}
+	}
+	return nil
+}
+
+// DayStart is the start of the UTC day daily limits are counted in.
+func DayStart(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour)
+}
+
+// DayEnd is when daily limits reset.
+func DayEnd(now time.Time) time.Time {
+	return DayStart(now).Add(24 * time.Hour)
+}
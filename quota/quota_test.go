@@ -0,0 +1,49 @@
+package quota_test
+
+import (
+	"github.com/astroniumm/go-asyncapi/quota"
+	"github.com/astroniumm/go-asyncapi/store"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestAdmit(t *testing.T) {
+	limits := quota.Limits{MaxConcurrentReports: 2, MaxDailyReports: 10, MaxRetainedBytes: 1000}
+
+	require.NoError(t, limits.Admit(&store.ReportUsage{ConcurrentReports: 1, DailyReports: 9, RetainedBytes: 999}))
+
+	var exceeded *quota.ExceededError
+	require.ErrorAs(t, limits.Admit(&store.ReportUsage{ConcurrentReports: 2}), &exceeded)
+	require.Equal(t, quota.ExceededError{Limit: quota.LimitConcurrentReports, Max: 2, Used: 2}, *exceeded)
+
+	require.ErrorAs(t, limits.Admit(&store.ReportUsage{DailyReports: 10}), &exceeded)
+	require.Equal(t, quota.LimitDailyReports, exceeded.Limit)
+
+	require.ErrorAs(t, limits.Admit(&store.ReportUsage{RetainedBytes: 1000}), &exceeded)
+	require.Equal(t, quota.LimitRetainedBytes, exceeded.Limit)
+
+	unlimited := quota.Limits{}
+	require.NoError(t, unlimited.Admit(&store.ReportUsage{ConcurrentReports: 100, DailyReports: 100, RetainedBytes: 1 << 40}))
+}
+
+func TestAdmitSchedule(t *testing.T) {
+	limits := quota.Limits{MaxSchedules: 2}
+	require.NoError(t, limits.AdmitSchedule(1))
+
+	var exceeded *quota.ExceededError
+	require.ErrorAs(t, limits.AdmitSchedule(2), &exceeded)
+	require.Equal(t, quota.ExceededError{Limit: quota.LimitSchedules, Max: 2, Used: 2}, *exceeded)
+
+	require.NoError(t, quota.Limits{}.AdmitSchedule(100))
+}
+
+func TestDay(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	// 00:30 in Berlin is still the previous day in UTC
+	now := time.Date(2025, 3, 10, 0, 30, 0, 0, berlin)
+	require.Equal(t, time.Date(2025, 3, 9, 0, 0, 0, 0, time.UTC), quota.DayStart(now))
+	require.Equal(t, time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC), quota.DayEnd(now))
+}
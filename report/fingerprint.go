@@ -0,0 +1,77 @@
+package report
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Fingerprint identifies the output a report request would produce, so
+// identical requests can share one report. Params are compared as JSON values,
+// key order and whitespace do not matter. Windows are compared as the instants
+// they cover, presets are resolved at now like the report will be, so a preset
+// only matches reports submitted while it covered the same range.
+func Fingerprint(reportType string, params json.RawMessage, window WindowSpec, format Format, gzip bool, now time.Time) (string, error) {
+	canonical, err := canonicalParams(params)
+	if err != nil {
+		return "", err
+	}
+
+	loc, err := window.Location()
+	if err != nil {
+		return "", err
+	}
+	resolved, err := window.Resolve(now)
+	if err != nil {
+		return "", err
+	}
+
+	key := struct {
+		Type     string          `json:"type"`
+		Params   json.RawMessage `json:"params"`
+		Start    string          `json:"start"`
+		End      string          `json:"end"`
+		Timezone string          `json:"timezone"`
+		Format   Format          `json:"format"`
+		Gzip     bool            `json:"gzip"`
+	}{
+		Type:     reportType,
+		Params:   canonical,
+		Start:    resolved.Start.UTC().Format(time.RFC3339Nano),
+		End:      resolved.End.UTC().Format(time.RFC3339Nano),
+		Timezone: loc.String(),
+		Format:   format,
+		Gzip:     gzip,
+	}
+
+	b, err := json.Marshal(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode report fingerprint: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// canonicalParams re-encodes params with sorted object keys and no insignificant
+// whitespace. Numbers keep their literal form.
+func canonicalParams(params json.RawMessage) (json.RawMessage, error) {
+	if len(bytes.TrimSpace(params)) == 0 {
+		return json.RawMessage("{}"), nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.UseNumber()
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return nil, fmt.Errorf("failed to decode report params: %w", err)
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode report params: %w", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,84 @@
+package report_test
+
+import (
+	"encoding/json"
+	"github.com/astroniumm/go-asyncapi/report"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestFingerprint(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	window := report.WindowSpec{Start: "2025-01-01T00:00:00Z", End: "2025-02-01T00:00:00Z"}
+	base, err := report.Fingerprint("signups", json.RawMessage(`{"a": 1, "b": [1, 2]}`), window, report.FormatCSV, false, now)
+	require.NoError(t, err)
+
+	same := []struct {
+		params json.RawMessage
+		window report.WindowSpec
+	}{
+		{json.RawMessage(`{"b":[1,2],"a":1}`), window},
+		{json.RawMessage(`{"a": 1, "b": [1, 2]}`), report.WindowSpec{Start: "2025-01-01T01:00:00+01:00", End: "2025-02-01T00:00:00Z", Timezone: "UTC"}},
+	}
+	for _, tc := range same {
+		fingerprint, err := report.Fingerprint("signups", tc.params, tc.window, report.FormatCSV, false, now)
+		require.NoError(t, err)
+		require.Equal(t, base, fingerprint, "%s %+v", tc.params, tc.window)
+	}
+
+	different := []struct {
+		reportType string
+		params     json.RawMessage
+		window     report.WindowSpec
+		format     report.Format
+		gzip       bool
+	}{
+		{"orders", json.RawMessage(`{"a":1,"b":[1,2]}`), window, report.FormatCSV, false},
+		{"signups", json.RawMessage(`{"a":1,"b":[2,1]}`), window, report.FormatCSV, false},
+		{"signups", json.RawMessage(`{"a":1.0,"b":[1,2]}`), window, report.FormatCSV, false},
+		{"signups", json.RawMessage(`{"a":1,"b":[1,2]}`), report.WindowSpec{Start: "2025-01-01", End: "2025-02-01", Timezone: "Europe/Berlin"}, report.FormatCSV, false},
+		{"signups", json.RawMessage(`{"a":1,"b":[1,2]}`), report.WindowSpec{Preset: report.PresetLast30Days}, report.FormatCSV, false},
+		{"signups", json.RawMessage(`{"a":1,"b":[1,2]}`), window, report.FormatNDJSON, false},
+		{"signups", json.RawMessage(`{"a":1,"b":[1,2]}`), window, report.FormatCSV, true},
+	}
+	for _, tc := range different {
+		fingerprint, err := report.Fingerprint(tc.reportType, tc.params, tc.window, tc.format, tc.gzip, now)
+		require.NoError(t, err)
+		require.NotEqual(t, base, fingerprint, "%+v", tc)
+	}
+}
+
+func TestFingerprintPresetTimezone(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	utc, err := report.Fingerprint("signups", nil, report.WindowSpec{Preset: report.PresetToday}, report.FormatCSV, false, now)
+	require.NoError(t, err)
+	explicit, err := report.Fingerprint("signups", json.RawMessage(`{}`), report.WindowSpec{Preset: report.PresetToday, Timezone: "UTC"}, report.FormatCSV, false, now)
+	require.NoError(t, err)
+	require.Equal(t, utc, explicit)
+
+	berlin, err := report.Fingerprint("signups", nil, report.WindowSpec{Preset: report.PresetToday, Timezone: "Europe/Berlin"}, report.FormatCSV, false, now)
+	require.NoError(t, err)
+	require.NotEqual(t, utc, berlin)
+}
+
+func TestFingerprintResolvesPresets(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	yesterday := report.WindowSpec{Preset: report.PresetYesterday}
+	base, err := report.Fingerprint("signups", nil, yesterday, report.FormatCSV, false, now)
+	require.NoError(t, err)
+
+	// later on the same day the preset covers the same range
+	later, err := report.Fingerprint("signups", nil, yesterday, report.FormatCSV, false, now.Add(6*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, base, later)
+
+	nextDay, err := report.Fingerprint("signups", nil, yesterday, report.FormatCSV, false, now.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.NotEqual(t, base, nextDay)
+
+	// a preset matches the absolute window it resolves to
+	absolute, err := report.Fingerprint("signups", nil, report.WindowSpec{Start: "2025-03-09T00:00:00Z", End: "2025-03-10T00:00:00Z"}, report.FormatCSV, false, now)
+	require.NoError(t, err)
+	require.Equal(t, base, absolute)
+}
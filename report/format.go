@@ -0,0 +1,224 @@
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// RowWriter receives the output of a generator: the column names once, then
+// one value per column for every row. Values are strings, integers, floats,
+// bools, time.Time or nil.
+type RowWriter interface {
+	WriteHeader(columns []string) error
+	WriteRow(values []any) error
+}
+
+type Format string
+
+const (
+	FormatCSV    Format = "csv"
+	FormatNDJSON Format = "ndjson"
+	FormatXLSX   Format = "xlsx"
+)
+
+var Formats = []Format{FormatCSV, FormatNDJSON, FormatXLSX}
+
+var ErrUnknownFormat = errors.New("unknown output format")
+
+func ParseFormat(s string) (Format, error) {
+	for _, format := range Formats {
+		if string(format) == s {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("%w %q, expected one of %v", ErrUnknownFormat, s, Formats)
+}
+
+// Output describes how the rows of a report are rendered.
+type Output struct {
+	Format Format
+	Gzip   bool
+}
+
+func (o Output) ContentType() string {
+	if o.Gzip {
+		return "application/gzip"
+	}
+	switch o.Format {
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "text/csv; charset=utf-8"
+	}
+}
+
+// Extension is the file extension of the output, including the leading dot.
+func (o Output) Extension() string {
+	ext := "." + string(o.Format)
+	if o.Gzip {
+		ext += ".gz"
+	}
+	return ext
+}
+
+// Encoder renders rows into an output. Close must be called to complete it.
+type Encoder interface {
+	RowWriter
+	Close() error
+}
+
+// NewEncoder returns an encoder writing the output to w. Closing the encoder
+// does not close w.
+func (o Output) NewEncoder(w io.Writer) (Encoder, error) {
+	var closers []func() error
+	if o.Gzip {
+		zw := gzip.NewWriter(w)
+		closers = append(closers, zw.Close)
+		w = zw
+	}
+
+	var enc Encoder
+	switch o.Format {
+	case FormatCSV:
+		enc = &csvEncoder{w: csv.NewWriter(w)}
+	case FormatNDJSON:
+		enc = &ndjsonEncoder{w: bufio.NewWriter(w)}
+	case FormatXLSX:
+		enc = newXLSXEncoder(w)
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownFormat, o.Format)
+	}
+
+	return &closingEncoder{Encoder: enc, closers: closers}, nil
+}
+
+// closingEncoder closes the writers wrapped around the output after the encoder.
+type closingEncoder struct {
+	Encoder
+	closers []func() error
+}
+
+func (e *closingEncoder) Close() error {
+	err := e.Encoder.Close()
+	for i := len(e.closers) - 1; i >= 0; i-- {
+		if cerr := e.closers[i](); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// formatValue renders a value as text for formats without typed cells.
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+type csvEncoder struct {
+	w      *csv.Writer
+	record []string
+}
+
+func (e *csvEncoder) WriteHeader(columns []string) error {
+	return e.w.Write(columns)
+}
+
+func (e *csvEncoder) WriteRow(values []any) error {
+	e.record = e.record[:0]
+	for _, v := range values {
+		e.record = append(e.record, formatValue(v))
+	}
+	return e.w.Write(e.record)
+}
+
+func (e *csvEncoder) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// ndjsonEncoder writes every row as a JSON object keyed by column name, keeping
+// the column order.
+type ndjsonEncoder struct {
+	w       *bufio.Writer
+	columns [][]byte
+	value   bytes.Buffer
+}
+
+// marshal encodes v without escaping HTML characters, which only matters for
+// JSON embedded in HTML.
+func (e *ndjsonEncoder) marshal(v any) ([]byte, error) {
+	e.value.Reset()
+	enc := json.NewEncoder(&e.value)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(e.value.Bytes(), []byte("\n")), nil
+}
+
+func (e *ndjsonEncoder) WriteHeader(columns []string) error {
+	e.columns = make([][]byte, len(columns))
+	for i, column := range columns {
+		key, err := e.marshal(column)
+		if err != nil {
+			return err
+		}
+		e.columns[i] = bytes.Clone(key)
+	}
+	return nil
+}
+
+func (e *ndjsonEncoder) WriteRow(values []any) error {
+	if len(values) != len(e.columns) {
+		return fmt.Errorf("row has %d values for %d columns", len(values), len(e.columns))
+	}
+
+	e.w.WriteByte('{')
+	for i, v := range values {
+		value, err := e.marshal(v)
+		if err != nil {
+			return fmt.Errorf("encoding column %s: %w", e.columns[i], err)
+		}
+		if i > 0 {
+			e.w.WriteByte(',')
+		}
+		e.w.Write(e.columns[i])
+		e.w.WriteByte(':')
+		e.w.Write(value)
+	}
+	e.w.WriteString("}\n")
+
+	return nil
+}
+
+func (e *ndjsonEncoder) Close() error {
+	return e.w.Flush()
+}
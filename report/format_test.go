@@ -0,0 +1,103 @@
+package report_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"github.com/astroniumm/go-asyncapi/report"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+	"time"
+)
+
+var (
+	testColumns = []string{"id", "email", "created_at", "orders", "active", "note"}
+	testRows    = [][]any{
+		{"u1", "a@example.com", time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), 3, true, nil},
+		{"u2", `b,"quoted"@example.com`, time.Date(2025, 2, 3, 4, 5, 6, 0, time.UTC), int64(0), false, "<none>"},
+	}
+)
+
+func render(t *testing.T, output report.Output) []byte {
+	var buf bytes.Buffer
+	enc, err := output.NewEncoder(&buf)
+	require.NoError(t, err)
+
+	require.NoError(t, enc.WriteHeader(testColumns))
+	for _, row := range testRows {
+		require.NoError(t, enc.WriteRow(row))
+	}
+	require.NoError(t, enc.Close())
+
+	return buf.Bytes()
+}
+
+func TestCSV(t *testing.T) {
+	out := render(t, report.Output{Format: report.FormatCSV})
+
+	require.Equal(t, "id,email,created_at,orders,active,note\n"+
+		"u1,a@example.com,2025-01-02T03:04:05Z,3,true,\n"+
+		`u2,"b,""quoted""@example.com",2025-02-03T04:05:06Z,0,false,<none>`+"\n", string(out))
+}
+
+func TestNDJSON(t *testing.T) {
+	out := render(t, report.Output{Format: report.FormatNDJSON})
+
+	require.Equal(t, `{"id":"u1","email":"a@example.com","created_at":"2025-01-02T03:04:05Z","orders":3,"active":true,"note":null}`+"\n"+
+		`{"id":"u2","email":"b,\"quoted\"@example.com","created_at":"2025-02-03T04:05:06Z","orders":0,"active":false,"note":"<none>"}`+"\n", string(out))
+}
+
+func TestXLSX(t *testing.T) {
+	out := render(t, report.Output{Format: report.FormatXLSX})
+
+	zr, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	require.NoError(t, err)
+
+	parts := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+		parts[f.Name] = string(content)
+	}
+
+	require.Contains(t, parts, "[Content_Types].xml")
+	require.Contains(t, parts, "_rels/.rels")
+	require.Contains(t, parts, "xl/workbook.xml")
+	require.Contains(t, parts, "xl/_rels/workbook.xml.rels")
+
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	require.Contains(t, sheet, `<row r="1"><c r="A1" t="inlineStr"><is><t xml:space="preserve">id</t></is></c>`)
+	require.Contains(t, sheet, `<c r="C2" t="inlineStr"><is><t xml:space="preserve">2025-01-02T03:04:05Z</t></is></c>`)
+	require.Contains(t, sheet, `<c r="D2"><v>3</v></c><c r="E2" t="b"><v>1</v></c></row>`)
+	require.Contains(t, sheet, `<c r="F3" t="inlineStr"><is><t xml:space="preserve">&lt;none&gt;</t></is></c>`)
+	require.True(t, bytes.HasSuffix([]byte(sheet), []byte(`</sheetData></worksheet>`)))
+}
+
+func TestGzip(t *testing.T) {
+	out := render(t, report.Output{Format: report.FormatCSV, Gzip: true})
+
+	zr, err := gzip.NewReader(bytes.NewReader(out))
+	require.NoError(t, err)
+	plain, err := io.ReadAll(zr)
+	require.NoError(t, err)
+
+	require.Equal(t, render(t, report.Output{Format: report.FormatCSV}), plain)
+}
+
+func TestOutput(t *testing.T) {
+	format, err := report.ParseFormat("xlsx")
+	require.NoError(t, err)
+	require.Equal(t, report.FormatXLSX, format)
+
+	_, err = report.ParseFormat("pdf")
+	require.ErrorIs(t, err, report.ErrUnknownFormat)
+
+	require.Equal(t, ".ndjson", report.Output{Format: report.FormatNDJSON}.Extension())
+	require.Equal(t, "application/x-ndjson", report.Output{Format: report.FormatNDJSON}.ContentType())
+	require.Equal(t, ".csv.gz", report.Output{Format: report.FormatCSV, Gzip: true}.Extension())
+	require.Equal(t, "application/gzip", report.Output{Format: report.FormatCSV, Gzip: true}.ContentType())
+}
@@ -0,0 +1,23 @@
+package report
+
+// Progress is a snapshot of how far a report has got.
+type Progress struct {
+	// Percent is how much of the report is done, from 0 to 100.
+	Percent float64
+	// Stage names what the generator is doing, e.g. "querying".
+	Stage         string
+	RowsProcessed int64
+}
+
+// ProgressReporter receives the progress of a running report from its generator.
+// Generators may report as often as they like, the service throttles what it
+// persists and publishes.
+type ProgressReporter interface {
+	Report(progress Progress)
+}
+
+type ProgressReporterFunc func(progress Progress)
+
+func (f ProgressReporterFunc) Report(progress Progress) {
+	f(progress)
+}
@@ -0,0 +1,106 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var ErrUnknownReportType = errors.New("unknown report type")
+
+// ReportGenerator produces the output of one report type.
+type ReportGenerator interface {
+	// Name is the report type stored alongside each report.
+	Name() string
+	// Schema is the JSON Schema the report parameters are validated against.
+	Schema() json.RawMessage
+	// Generate writes the rows of the report, the service renders them in the
+	// output format requested for it. How far it has got is told to progress.
+	Generate(ctx context.Context, req Request, w RowWriter, progress ProgressReporter) error
+}
+
+// Request is what a report is generated for.
+type Request struct {
+	// Params match the schema of the report type.
+	Params json.RawMessage
+	// Window is the time range the report covers.
+	Window Window
+}
+
+type Registry struct {
+	mu         sync.RWMutex
+	generators map[string]ReportGenerator
+	schemas    map[string]*Schema
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		generators: map[string]ReportGenerator{},
+		schemas:    map[string]*Schema{},
+	}
+}
+
+func (r *Registry) Register(generator ReportGenerator) error {
+	name := generator.Name()
+	if name == "" {
+		return errors.New("report type name must not be empty")
+	}
+
+	schema, err := ParseSchema(generator.Schema())
+	if err != nil {
+		return fmt.Errorf("report type %q: %w", name, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.generators[name]; ok {
+		return fmt.Errorf("report type %q is already registered", name)
+	}
+	r.generators[name] = generator
+	r.schemas[name] = schema
+
+	return nil
+}
+
+func (r *Registry) Get(name string) (ReportGenerator, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	generator, ok := r.generators[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownReportType, name)
+	}
+	return generator, nil
+}
+
+// Validate checks that the report type exists and params match its schema.
+func (r *Registry) Validate(name string, params json.RawMessage) error {
+	r.mu.RLock()
+	schema, ok := r.schemas[name]
+	r.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownReportType, name)
+	}
+
+	return schema.Validate(params)
+}
+
+// Generators returns all registered report types ordered by name.
+func (r *Registry) Generators() []ReportGenerator {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	generators := make([]ReportGenerator, 0, len(r.generators))
+	for _, generator := range r.generators {
+		generators = append(generators, generator)
+	}
+	sort.Slice(generators, func(i, j int) bool {
+		return generators[i].Name() < generators[j].Name()
+	})
+
+	return generators
+}
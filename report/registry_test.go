@@ -0,0 +1,76 @@
+package report_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/astroniumm/go-asyncapi/report"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type testGenerator struct {
+	name   string
+	schema string
+}
+
+func (g testGenerator) Name() string { return g.name }
+
+func (g testGenerator) Schema() json.RawMessage { return json.RawMessage(g.schema) }
+
+func (g testGenerator) Generate(ctx context.Context, req report.Request, w report.RowWriter, progress report.ProgressReporter) error {
+	return w.WriteRow([]any{string(req.Params)})
+}
+
+func TestRegistry(t *testing.T) {
+	registry := report.NewRegistry()
+	require.NoError(t, registry.Register(testGenerator{
+		name: "orders",
+		schema: `{
+			"type": "object",
+			"properties": {
+				"from": {"type": "string", "format": "date-time"},
+				"limit": {"type": "integer", "minimum": 1, "maximum": 100},
+				"status": {"type": "string", "enum": ["open", "closed"]},
+				"tags": {"type": "array", "items": {"type": "string", "maxLength": 3}}
+			},
+			"required": ["from"],
+			"additionalProperties": false
+		}`,
+	}))
+
+	require.Error(t, registry.Register(testGenerator{name: "orders", schema: `{}`}))
+	require.Error(t, registry.Register(testGenerator{name: "broken", schema: `{`}))
+
+	_, err := registry.Get("missing")
+	require.True(t, errors.Is(err, report.ErrUnknownReportType))
+	require.True(t, errors.Is(registry.Validate("missing", json.RawMessage(`{}`)), report.ErrUnknownReportType))
+
+	valid := []string{
+		`{"from": "2025-01-01T00:00:00Z"}`,
+		`{"from": "2025-01-01T00:00:00Z", "limit": 10, "status": "open", "tags": ["a", "abc"]}`,
+	}
+	for _, params := range valid {
+		require.NoError(t, registry.Validate("orders", json.RawMessage(params)), params)
+	}
+
+	invalid := []string{
+		`[]`,
+		`{}`,
+		`{"from": "yesterday"}`,
+		`{"from": "2025-01-01T00:00:00Z", "limit": 1.5}`,
+		`{"from": "2025-01-01T00:00:00Z", "limit": 0}`,
+		`{"from": "2025-01-01T00:00:00Z", "limit": 101}`,
+		`{"from": "2025-01-01T00:00:00Z", "status": "pending"}`,
+		`{"from": "2025-01-01T00:00:00Z", "tags": ["abcd"]}`,
+		`{"from": "2025-01-01T00:00:00Z", "unknown": true}`,
+		`{"from": `,
+	}
+	for _, params := range invalid {
+		require.Error(t, registry.Validate("orders", json.RawMessage(params)), params)
+	}
+
+	generators := registry.Generators()
+	require.Len(t, generators, 1)
+	require.Equal(t, "orders", generators[0].Name())
+}
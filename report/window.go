@@ -0,0 +1,149 @@
+package report
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Presets are windows relative to when a report was submitted or scheduled for,
+// "now" below. Day and month boundaries are taken in the timezone of the window.
+const (
+	// PresetLast24Hours covers the 24 hours before now.
+	PresetLast24Hours = "last_24_hours"
+	// PresetToday covers the current day up to now.
+	PresetToday = "today"
+	// PresetYesterday covers the previous day.
+	PresetYesterday = "yesterday"
+	// PresetLast7Days covers the 7 days before the current one.
+	PresetLast7Days = "last_7_days"
+	// PresetLast30Days covers the 30 days before the current one.
+	PresetLast30Days = "last_30_days"
+	// PresetThisMonth covers the current month up to now.
+	PresetThisMonth = "this_month"
+	// PresetLastMonth covers the previous month.
+	PresetLastMonth = "last_month"
+)
+
+var Presets = []string{
+	PresetLast24Hours, PresetToday, PresetYesterday, PresetLast7Days, PresetLast30Days, PresetThisMonth, PresetLastMonth,
+}
+
+// localTimeLayouts are accepted for window bounds without an offset, they are
+// read in the timezone of the window.
+var localTimeLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+
+// WindowSpec is the time range a report should cover as requested: absolute
+// start and end, or a preset resolved when the report runs. Timezone defaults
+// to UTC.
+type WindowSpec struct {
+	Start    string `json:"start,omitempty"`
+	End      string `json:"end,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+	Preset   string `json:"preset,omitempty"`
+}
+
+// Window is a resolved time range, Start inclusive and End exclusive.
+type Window struct {
+	Start    time.Time
+	End      time.Time
+	Timezone string
+}
+
+func (s WindowSpec) Validate() error {
+	if _, err := s.Location(); err != nil {
+		return err
+	}
+
+	if s.Preset != "" {
+		if s.Start != "" || s.End != "" {
+			return errors.New("window takes either a preset or start and end, not both")
+		}
+		if !slices.Contains(Presets, s.Preset) {
+			return fmt.Errorf("unknown window preset %q, expected one of %v", s.Preset, Presets)
+		}
+		return nil
+	}
+
+	if s.Start == "" || s.End == "" {
+		return errors.New("window needs a start and an end, or a preset")
+	}
+	_, err := s.Resolve(time.Time{})
+	return err
+}
+
+// Location is the timezone of the window.
+func (s WindowSpec) Location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown window timezone %q", s.Timezone)
+	}
+	return loc, nil
+}
+
+// Resolve turns the spec into concrete instants, presets relative to now.
+func (s WindowSpec) Resolve(now time.Time) (Window, error) {
+	loc, err := s.Location()
+	if err != nil {
+		return Window{}, err
+	}
+	window := Window{Timezone: loc.String()}
+
+	if s.Preset != "" {
+		window.Start, window.End, err = resolvePreset(s.Preset, now.In(loc))
+		return window, err
+	}
+
+	if window.Start, err = parseWindowTime(s.Start, loc); err != nil {
+		return Window{}, fmt.Errorf("invalid window start: %w", err)
+	}
+	if window.End, err = parseWindowTime(s.End, loc); err != nil {
+		return Window{}, fmt.Errorf("invalid window end: %w", err)
+	}
+	if !window.Start.Before(window.End) {
+		return Window{}, errors.New("window start must be before its end")
+	}
+
+	return window, nil
+}
+
+func parseWindowTime(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range localTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is neither RFC 3339 nor a local date or time", value)
+}
+
+func resolvePreset(preset string, now time.Time) (time.Time, time.Time, error) {
+	loc := now.Location()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+
+	switch preset {
+	case PresetLast24Hours:
+		return now.Add(-24 * time.Hour), now, nil
+	case PresetToday:
+		return today, now, nil
+	case PresetYesterday:
+		return today.AddDate(0, 0, -1), today, nil
+	case PresetLast7Days:
+		return today.AddDate(0, 0, -7), today, nil
+	case PresetLast30Days:
+		return today.AddDate(0, 0, -30), today, nil
+	case PresetThisMonth:
+		return month, now, nil
+	case PresetLastMonth:
+		return month.AddDate(0, -1, 0), month, nil
+	default:
+		return time.Time{}, time.Time{}, fmt.Errorf("unknown window preset %q, expected one of %v", preset, Presets)
+	}
+}
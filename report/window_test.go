@@ -0,0 +1,77 @@
+package report_test
+
+import (
+	"github.com/astroniumm/go-asyncapi/report"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestWindowSpecValidate(t *testing.T) {
+	valid := []report.WindowSpec{
+		{Start: "2025-01-01T00:00:00Z", End: "2025-02-01T00:00:00Z"},
+		{Start: "2025-01-01", End: "2025-02-01", Timezone: "Europe/Berlin"},
+		{Preset: report.PresetLast7Days, Timezone: "America/New_York"},
+	}
+	for _, spec := range valid {
+		require.NoError(t, spec.Validate(), "%+v", spec)
+	}
+
+	invalid := []report.WindowSpec{
+		{},
+		{Start: "2025-01-01T00:00:00Z"},
+		{Start: "2025-02-01", End: "2025-01-01"},
+		{Start: "2025-01-01", End: "2025-01-01"},
+		{Start: "yesterday", End: "2025-01-01"},
+		{Preset: "last_week"},
+		{Preset: report.PresetToday, Start: "2025-01-01"},
+		{Preset: report.PresetToday, Timezone: "Mars/Olympus_Mons"},
+	}
+	for _, spec := range invalid {
+		require.Error(t, spec.Validate(), "%+v", spec)
+	}
+}
+
+func TestWindowSpecResolveAbsolute(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	window, err := report.WindowSpec{Start: "2025-01-01", End: "2025-01-02T12:00:00+00:00", Timezone: "Europe/Berlin"}.Resolve(time.Now())
+	require.NoError(t, err)
+	require.True(t, time.Date(2025, 1, 1, 0, 0, 0, 0, berlin).Equal(window.Start))
+	require.True(t, time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC).Equal(window.End))
+	require.Equal(t, "Europe/Berlin", window.Timezone)
+}
+
+func TestWindowSpecResolvePresets(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	// 2025-03-31 00:30 in Berlin, the day after the switch to summer time
+	now := time.Date(2025, 3, 30, 22, 30, 0, 0, time.UTC)
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2025, month, d, 0, 0, 0, 0, berlin)
+	}
+
+	cases := map[string][2]time.Time{
+		report.PresetLast24Hours: {now.Add(-24 * time.Hour), now},
+		report.PresetToday:       {day(3, 31), now},
+		// a 23 hour day
+		report.PresetYesterday:  {day(3, 30), day(3, 31)},
+		report.PresetLast7Days:  {day(3, 24), day(3, 31)},
+		report.PresetLast30Days: {day(3, 1), day(3, 31)},
+		report.PresetThisMonth:  {day(3, 1), now},
+		report.PresetLastMonth:  {day(2, 1), day(3, 1)},
+	}
+	for preset, want := range cases {
+		window, err := report.WindowSpec{Preset: preset, Timezone: "Europe/Berlin"}.Resolve(now)
+		require.NoError(t, err, preset)
+		require.True(t, want[0].Equal(window.Start), "%s start: %s", preset, window.Start)
+		require.True(t, want[1].Equal(window.End), "%s end: %s", preset, window.End)
+	}
+
+	window, err := report.WindowSpec{Preset: report.PresetYesterday}.Resolve(now)
+	require.NoError(t, err)
+	require.Equal(t, "UTC", window.Timezone)
+	require.True(t, time.Date(2025, 3, 29, 0, 0, 0, 0, time.UTC).Equal(window.Start))
+}
@@ -0,0 +1,40 @@
+// Package retry holds the backoff shared by the jobs that retry failed work:
+// reports, webhook deliveries and outbox messages.
+package retry
+
+import "time"
+
+type Policy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+}
+
+// defaultMaxBackoff caps delays of policies without a MaxBackoff.
+const defaultMaxBackoff = 24 * time.Hour
+
+// Delay returns how long to wait before the attempt following the given one:
+// Backoff doubled for every previous attempt and capped at MaxBackoff, or at a
+// day when MaxBackoff is not set.
+func (p Policy) Delay(attempt int) time.Duration {
+	if p.Backoff <= 0 {
+		return 0
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+
+	delay := p.Backoff
+	// stops doubling at the cap, so the delay cannot overflow however many attempts were made
+	for i := 1; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+
+	return min(delay, maxBackoff)
+}
+
+// CanRetry reports whether another attempt is allowed after the given one.
+func (p Policy) CanRetry(attempt int) bool {
+	return attempt < p.MaxAttempts
+}
@@ -0,0 +1,18 @@
+package retry_test
+
+import (
+	"github.com/astroniumm/go-asyncapi/retry"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestPolicyDelayWithoutMaxBackoff(t *testing.T) {
+	policy := retry.Policy{Backoff: 30 * time.Second}
+	require.Equal(t, time.Minute, policy.Delay(2))
+	// falls back to a cap instead of overflowing into negative delays
+	require.Equal(t, 24*time.Hour, policy.Delay(100))
+	require.Equal(t, 24*time.Hour, policy.Delay(1<<20))
+
+	require.Zero(t, retry.Policy{}.Delay(10))
+}
@@ -0,0 +1,108 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"github.com/astroniumm/go-asyncapi/store"
+	"github.com/robfig/cron/v3"
+	"strings"
+	"time"
+)
+
+// Misfire policies decide what happens to runs missed while no scheduler was running.
+const (
+	// MisfireRunOnce enqueues a single report for the latest missed run.
+	MisfireRunOnce = "run_once"
+	// MisfireRunAll enqueues a report for every missed run.
+	MisfireRunAll = "run_all"
+	// MisfireSkip drops missed runs and waits for the next one.
+	MisfireSkip = "skip"
+)
+
+var MisfirePolicies = []string{MisfireRunOnce, MisfireRunAll, MisfireSkip}
+
+// maxRunsPerFire bounds how many missed runs MisfireRunAll enqueues at a time,
+// the remaining ones are enqueued when the schedule fires again.
+const maxRunsPerFire = 100
+
+// Parse parses a standard five field cron expression, or a descriptor such as
+// @daily, evaluated in the named timezone.
+func Parse(expr, timezone string) (cron.Schedule, error) {
+	if strings.HasPrefix(expr, "TZ=") || strings.HasPrefix(expr, "CRON_TZ=") {
+		return nil, errors.New("the timezone must be set separately from the cron expression")
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", timezone)
+	}
+
+	schedule, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression: %w", err)
+	}
+	if spec, ok := schedule.(*cron.SpecSchedule); ok {
+		spec.Location = loc
+	}
+	// e.g. "0 0 30 2 *", Next gives up and returns the zero time
+	if schedule.Next(time.Now()).IsZero() {
+		return nil, errors.New("invalid cron expression: it never fires")
+	}
+
+	return schedule, nil
+}
+
+// Plan decides which runs of a due schedule to enqueue at now according to its
+// misfire policy, and when it is due next. Runs that are at most grace late are
+// not considered missed.
+func Plan(s *store.ReportSchedule, now time.Time, grace time.Duration) (*store.SchedulePlan, error) {
+	schedule, err := Parse(s.CronExpr, s.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan *store.SchedulePlan
+	due := s.NextRunAt
+	switch s.MisfirePolicy {
+	case MisfireRunAll:
+		plan = &store.SchedulePlan{}
+		for !due.After(now) && len(plan.RunTimes) < maxRunsPerFire {
+			plan.RunTimes = append(plan.RunTimes, due)
+			due = schedule.Next(due)
+		}
+		plan.NextRunAt = due
+	case MisfireSkip:
+		latest := latestRun(schedule, due, now)
+		plan = &store.SchedulePlan{NextRunAt: schedule.Next(latest)}
+		if now.Sub(latest) <= grace {
+			plan.RunTimes = []time.Time{latest}
+		}
+	case MisfireRunOnce, "":
+		latest := latestRun(schedule, due, now)
+		plan = &store.SchedulePlan{RunTimes: []time.Time{latest}, NextRunAt: schedule.Next(latest)}
+	default:
+		return nil, fmt.Errorf("unknown misfire policy %q", s.MisfirePolicy)
+	}
+
+	// report times are shown in the timezone of the schedule
+	loc, _ := time.LoadLocation(s.Timezone)
+	for i := range plan.RunTimes {
+		plan.RunTimes[i] = plan.RunTimes[i].In(loc)
+	}
+	if plan.NextRunAt.IsZero() {
+		return nil, errors.New("the cron expression has no further runs")
+	}
+
+	return plan, nil
+}
+
+// latestRun returns the last run at or before now, starting from the due run.
+func latestRun(schedule cron.Schedule, due, now time.Time) time.Time {
+	for {
+		next := schedule.Next(due)
+		if next.IsZero() || next.After(now) {
+			return due
+		}
+		due = next
+	}
+}
@@ -0,0 +1,116 @@
+package schedule_test
+
+import (
+	"github.com/astroniumm/go-asyncapi/schedule"
+	"github.com/astroniumm/go-asyncapi/store"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	cronSchedule, err := schedule.Parse("0 8 * * MON", "Europe/Berlin")
+	require.NoError(t, err)
+
+	// Wednesday 2024-03-27, the following Monday is the first one in summer time
+	next := cronSchedule.Next(time.Date(2024, 3, 27, 12, 0, 0, 0, time.UTC))
+	require.Equal(t, time.Date(2024, 4, 1, 8, 0, 0, 0, berlin).Unix(), next.Unix())
+	require.Equal(t, time.Date(2024, 4, 1, 6, 0, 0, 0, time.UTC).Unix(), next.Unix())
+
+	_, err = schedule.Parse("@daily", "UTC")
+	require.NoError(t, err)
+
+	_, err = schedule.Parse("0 8 * *", "UTC")
+	require.Error(t, err)
+	_, err = schedule.Parse("0 8 * * MON", "Mars/Olympus_Mons")
+	require.Error(t, err)
+	_, err = schedule.Parse("CRON_TZ=UTC 0 8 * * MON", "Europe/Berlin")
+	require.Error(t, err)
+	// February never has a 30th
+	_, err = schedule.Parse("0 0 30 2 *", "UTC")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "never fires")
+}
+
+func hourly(policy string, nextRunAt time.Time) *store.ReportSchedule {
+	return &store.ReportSchedule{
+		CronExpr:      "0 * * * *",
+		Timezone:      "UTC",
+		MisfirePolicy: policy,
+		NextRunAt:     nextRunAt,
+	}
+}
+
+func TestPlanOnTime(t *testing.T) {
+	due := time.Date(2024, 5, 6, 8, 0, 0, 0, time.UTC)
+	now := due.Add(5 * time.Second)
+
+	for _, policy := range schedule.MisfirePolicies {
+		plan, err := schedule.Plan(hourly(policy, due), now, time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, []time.Time{due}, plan.RunTimes, policy)
+		require.Equal(t, due.Add(time.Hour), plan.NextRunAt, policy)
+	}
+}
+
+func TestPlanMissedRuns(t *testing.T) {
+	due := time.Date(2024, 5, 6, 8, 0, 0, 0, time.UTC)
+	// down from 07:59 until 11:30, the 08:00, 09:00, 10:00 and 11:00 runs were missed
+	now := due.Add(3*time.Hour + 30*time.Minute)
+	next := time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC)
+
+	plan, err := schedule.Plan(hourly(schedule.MisfireRunOnce, due), now, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, []time.Time{due.Add(3 * time.Hour)}, plan.RunTimes)
+	require.Equal(t, next, plan.NextRunAt)
+
+	plan, err = schedule.Plan(hourly(schedule.MisfireRunAll, due), now, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, []time.Time{due, due.Add(time.Hour), due.Add(2 * time.Hour), due.Add(3 * time.Hour)}, plan.RunTimes)
+	require.Equal(t, next, plan.NextRunAt)
+
+	plan, err = schedule.Plan(hourly(schedule.MisfireSkip, due), now, time.Minute)
+	require.NoError(t, err)
+	require.Empty(t, plan.RunTimes)
+	require.Equal(t, next, plan.NextRunAt)
+}
+
+func TestPlanRunAllIsBounded(t *testing.T) {
+	due := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := due.AddDate(0, 1, 0)
+
+	plan, err := schedule.Plan(hourly(schedule.MisfireRunAll, due), now, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, plan.RunTimes, 100)
+	// the remaining runs are still due
+	require.True(t, plan.NextRunAt.Before(now))
+}
+
+func TestPlanReportsRunsInScheduleTimezone(t *testing.T) {
+	s := &store.ReportSchedule{
+		CronExpr:      "0 8 * * MON",
+		Timezone:      "Europe/Berlin",
+		MisfirePolicy: schedule.MisfireRunOnce,
+		NextRunAt:     time.Date(2024, 5, 6, 6, 0, 0, 0, time.UTC),
+	}
+
+	plan, err := schedule.Plan(s, s.NextRunAt.Add(time.Second), time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, "2024-05-06T08:00:00+02:00", plan.RunTimes[0].Format(time.RFC3339))
+	require.Equal(t, time.Date(2024, 5, 13, 6, 0, 0, 0, time.UTC).Unix(), plan.NextRunAt.Unix())
+}
+
+func TestPlanNeverFires(t *testing.T) {
+	s := hourly(schedule.MisfireRunOnce, time.Now())
+	s.CronExpr = "0 0 30 2 *"
+	_, err := schedule.Plan(s, time.Now(), time.Minute)
+	require.Error(t, err)
+}
+
+func TestPlanUnknownPolicy(t *testing.T) {
+	_, err := schedule.Plan(hourly("sometimes", time.Now()), time.Now(), time.Minute)
+	require.Error(t, err)
+}
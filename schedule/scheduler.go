@@ -0,0 +1,80 @@
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/astroniumm/go-asyncapi/config"
+	"github.com/astroniumm/go-asyncapi/quota"
+	"github.com/astroniumm/go-asyncapi/store"
+	"log/slog"
+	"time"
+)
+
+// Scheduler enqueues the reports of due schedules. Any number of replicas can
+// run one, each due run is enqueued by exactly one of them.
+type Scheduler struct {
+	config    *config.Config
+	logger    *slog.Logger
+	schedules *store.SchedulesStore
+}
+
+func NewScheduler(config *config.Config, logger *slog.Logger, schedules *store.SchedulesStore) *Scheduler {
+	return &Scheduler{
+		config:    config,
+		logger:    logger,
+		schedules: schedules,
+	}
+}
+
+// Run fires due schedules every SchedulerInterval until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.config.SchedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		s.fireDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) fireDue(ctx context.Context) {
+	limits := quota.FromConfig(s.config)
+	for ctx.Err() == nil {
+		now := time.Now()
+		schedule, reports, err := s.schedules.FireDue(ctx, func(schedule *store.ReportSchedule) (*store.SchedulePlan, error) {
+			return Plan(schedule, now, s.config.SchedulerMisfireGrace)
+		}, quota.DayStart(now), limits.Admit)
+		if schedule == nil {
+			if !errors.Is(err, sql.ErrNoRows) && ctx.Err() == nil {
+				s.logger.Error("failed to fire report schedule", "error", err)
+			}
+			return
+		}
+
+		var exceeded *quota.ExceededError
+		switch {
+		case errors.As(err, &exceeded):
+			s.logger.Warn("runs of report schedule skipped over quota", "error", err, "schedule_id", schedule.ID,
+				"user_id", schedule.UserID, "next_run_at", schedule.NextRunAt)
+		case err != nil:
+			// the schedule was disabled or put off, the others can still fire
+			s.logger.Error("failed to fire report schedule", "error", err, "schedule_id", schedule.ID,
+				"user_id", schedule.UserID, "disabled", schedule.DisabledAt != nil, "next_run_at", schedule.NextRunAt)
+			continue
+		}
+
+		for _, report := range reports {
+			s.logger.Info("scheduled report enqueued", "schedule_id", schedule.ID, "report_id", report.ID,
+				"user_id", report.UserID, "scheduled_at", report.ScheduledAt)
+		}
+		if len(reports) == 0 && err == nil {
+			s.logger.Info("missed runs of report schedule skipped", "schedule_id", schedule.ID, "next_run_at", schedule.NextRunAt)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"fmt"
+	"github.com/astroniumm/go-asyncapi/asyncapi"
+	"github.com/astroniumm/go-asyncapi/store"
+	"github.com/astroniumm/go-asyncapi/webhook"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// asyncAPIVersion is the version of the asynchronous interface described by
+// the document. Bump it with changes that break consumers.
+const asyncAPIVersion = "1.0.0"
+
+const (
+	serverAPI       = "api"
+	serverWebSocket = "websocket"
+
+	channelReportEvents = "reportEvents"
+	channelReportsWS    = "reportsWebSocket"
+	channelWebhooks     = "webhooks"
+	channelDomainEvents = "domainEvents"
+)
+
+// AsyncAPIDocument describes the events the service sends and receives: the
+// report status stream, the reports websocket, webhook deliveries and the
+// domain events published through the outbox. Payloads
+// are derived from the Go types that encode them, baseURL is where the API is
+// reachable.
+func AsyncAPIDocument(baseURL string) (*asyncapi.Document, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid public url %q", baseURL)
+	}
+	wsProtocol := "ws"
+	if u.Scheme == "https" {
+		wsProtocol = "wss"
+	}
+	pathname := strings.TrimSuffix(u.Path, "/")
+
+	r := asyncapi.NewReflector()
+	asyncapi.Enum(r, store.ReportStatuses...)
+
+	doc := &asyncapi.Document{
+		AsyncAPI: asyncapi.Version,
+		Info: asyncapi.Info{
+			Title:       "go-asyncapi reports",
+			Version:     asyncAPIVersion,
+			Description: "Status updates and progress of asynchronously generated reports, streamed to API clients and delivered to webhooks.",
+		},
+		Servers: map[string]asyncapi.Server{
+			serverAPI: {
+				Host:        u.Host,
+				Protocol:    u.Scheme,
+				Pathname:    pathname,
+				Description: "The HTTP API. Streams require a bearer access token.",
+			},
+			serverWebSocket: {
+				Host:        u.Host,
+				Protocol:    wsProtocol,
+				Pathname:    pathname,
+				Description: "The websocket endpoint of the API. The access token may be passed in the access_token query parameter.",
+			},
+		},
+		DefaultContentType: "application/json",
+		Channels:           map[string]asyncapi.Channel{},
+		Operations:         map[string]asyncapi.Operation{},
+		Components:         asyncapi.Components{Messages: map[string]asyncapi.Message{}},
+	}
+
+	doc.Components.Messages["reportStatus"] = asyncapi.Message{
+		Name:        reportStatusEvent,
+		Title:       "Report status changed",
+		Description: "Sent as a server-sent event named " + reportStatusEvent + " whose id is the event id. Clients resume with the Last-Event-ID header.",
+		Payload:     r.Schema(reportEventResponse{}),
+	}
+	doc.Channels[channelReportEvents] = asyncapi.Channel{
+		Address:     "/reports/events",
+		Title:       "Report status stream",
+		Description: "Server-sent events with the status transitions of the reports of the authenticated user.",
+		Servers:     []asyncapi.Reference{asyncapi.ServerRef(serverAPI)},
+		Messages:    map[string]asyncapi.Reference{"reportStatus": asyncapi.MessageRef("reportStatus")},
+	}
+	doc.Operations["sendReportStatus"] = asyncapi.Operation{
+		Action:   asyncapi.ActionSend,
+		Channel:  asyncapi.ChannelRef(channelReportEvents),
+		Summary:  "Stream report status transitions.",
+		Messages: []asyncapi.Reference{asyncapi.ChannelMessageRef(channelReportEvents, "reportStatus")},
+	}
+
+	wsMessages := []struct {
+		key, typ, title string
+		payload         any
+	}{
+		{"wsSubscribe", wsMessageSubscribe, "Follow reports", wsClientMessage{}},
+		{"wsUnsubscribe", wsMessageUnsubscribe, "Stop following reports", wsClientMessage{}},
+		{"wsStatus", wsMessageStatus, "Report status", wsServerMessage{}},
+		{"wsProgress", wsMessageProgress, "Report progress", wsServerMessage{}},
+		{"wsError", wsMessageError, "Error", wsServerMessage{}},
+	}
+	wsChannel := asyncapi.Channel{
+		Address:     "/reports/ws",
+		Title:       "Reports websocket",
+		Description: "Follows a set of reports of the authenticated user over one connection. Status messages carry the current status right after subscribing and every transition afterwards.",
+		Servers:     []asyncapi.Reference{asyncapi.ServerRef(serverWebSocket)},
+		Messages:    map[string]asyncapi.Reference{},
+	}
+	var wsReceived, wsSent []asyncapi.Reference
+	for _, m := range wsMessages {
+		payload := r.Schema(m.payload)
+		payload.Properties["type"] = &asyncapi.Schema{Type: "string", Const: m.typ}
+		doc.Components.Messages[m.key] = asyncapi.Message{Name: m.typ, Title: m.title, Payload: payload}
+		wsChannel.Messages[m.key] = asyncapi.MessageRef(m.key)
+
+		if _, ok := m.payload.(wsClientMessage); ok {
+			wsReceived = append(wsReceived, asyncapi.ChannelMessageRef(channelReportsWS, m.key))
+		} else {
+			wsSent = append(wsSent, asyncapi.ChannelMessageRef(channelReportsWS, m.key))
+		}
+	}
+	doc.Channels[channelReportsWS] = wsChannel
+	doc.Operations["receiveWebSocketSubscriptions"] = asyncapi.Operation{
+		Action:   asyncapi.ActionReceive,
+		Channel:  asyncapi.ChannelRef(channelReportsWS),
+		Summary:  "Change the set of followed reports.",
+		Messages: wsReceived,
+	}
+	doc.Operations["sendWebSocketUpdates"] = asyncapi.Operation{
+		Action:   asyncapi.ActionSend,
+		Channel:  asyncapi.ChannelRef(channelReportsWS),
+		Summary:  "Send status and progress of followed reports.",
+		Messages: wsSent,
+	}
+
+	webhooksChannel := asyncapi.Channel{
+		Title:       "Webhooks",
+		Description: "Posted to the url of every webhook subscribed to the event. Deliveries are retried with backoff until the endpoint answers with a 2xx status.",
+		Messages:    map[string]asyncapi.Reference{},
+	}
+	var webhookMessages []asyncapi.Reference
+	for _, event := range store.WebhookEvents {
+		key := "webhook." + event
+		payload := r.Schema(store.WebhookPayload{})
+		payload.Properties["event"] = &asyncapi.Schema{Type: "string", Const: event}
+		doc.Components.Messages[key] = asyncapi.Message{
+			Name:    event,
+			Title:   "Webhook " + event,
+			Headers: webhookHeaders(event),
+			Payload: payload,
+		}
+		webhooksChannel.Messages[event] = asyncapi.MessageRef(key)
+		webhookMessages = append(webhookMessages, asyncapi.ChannelMessageRef(channelWebhooks, event))
+	}
+	doc.Channels[channelWebhooks] = webhooksChannel
+	doc.Operations["sendWebhooks"] = asyncapi.Operation{
+		Action:   asyncapi.ActionSend,
+		Channel:  asyncapi.ChannelRef(channelWebhooks),
+		Summary:  "Deliver report events to webhooks.",
+		Messages: webhookMessages,
+	}
+
+	type domainEvent struct {
+		event, title string
+		payload      any
+	}
+	domainEvents := []domainEvent{{store.OutboxEventUserCreated, "User signed up", store.UserCreated{}}}
+	for _, status := range store.ReportStatuses {
+		domainEvents = append(domainEvents, domainEvent{store.ReportOutboxEvent(status), "Report " + string(status), store.ReportStatusChanged{}})
+	}
+	domainChannel := asyncapi.Channel{
+		Title: "Domain events",
+		Description: "Published by the outbox relay at least once and in order per user or report. Until the service is connected to a broker " +
+			"the events are only logged, they are not available to consumers yet. Consumers should deduplicate by message id.",
+		Messages: map[string]asyncapi.Reference{},
+	}
+	var domainMessages []asyncapi.Reference
+	for _, e := range domainEvents {
+		key := "domain." + e.event
+		doc.Components.Messages[key] = asyncapi.Message{Name: e.event, Title: e.title, Payload: r.Schema(e.payload)}
+		domainChannel.Messages[e.event] = asyncapi.MessageRef(key)
+		domainMessages = append(domainMessages, asyncapi.ChannelMessageRef(channelDomainEvents, e.event))
+	}
+	doc.Channels[channelDomainEvents] = domainChannel
+	doc.Operations["sendDomainEvents"] = asyncapi.Operation{
+		Action:   asyncapi.ActionSend,
+		Channel:  asyncapi.ChannelRef(channelDomainEvents),
+		Summary:  "Publish user and report changes recorded in the outbox.",
+		Messages: domainMessages,
+	}
+
+	return doc, nil
+}
+
+func webhookHeaders(event string) *asyncapi.Schema {
+	return &asyncapi.Schema{
+		Type: "object",
+		Properties: map[string]*asyncapi.Schema{
+			webhook.HeaderDeliveryID: {Type: "string", Description: "Id of the delivery, the same for every attempt."},
+			webhook.HeaderEvent:      {Type: "string", Const: event},
+			webhook.HeaderTimestamp:  {Type: "string", Description: "Unix time the attempt was sent at, in seconds."},
+			webhook.HeaderSignature:  {Type: "string", Description: `"sha256=" and the hex encoded HMAC-SHA256 of "<timestamp>.<body>" keyed with the webhook secret.`},
+		},
+		Required: []string{webhook.HeaderDeliveryID, webhook.HeaderEvent, webhook.HeaderTimestamp, webhook.HeaderSignature},
+	}
+}
+
+func (s *Server) asyncAPIHandler(yaml bool) http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		doc, err := AsyncAPIDocument(s.Downloads.BaseURL())
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		contentType := "application/json"
+		marshal := doc.JSON
+		if yaml {
+			contentType = "application/yaml"
+			marshal = doc.YAML
+		}
+		b, err := marshal()
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(b)
+		return nil
+	})
+}
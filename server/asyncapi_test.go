@@ -0,0 +1,31 @@
+package server_test
+
+import (
+	"flag"
+	"github.com/astroniumm/go-asyncapi/server"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+var updateAsyncAPI = flag.Bool("update-asyncapi", false, "rewrite the committed AsyncAPI document")
+
+// asyncAPIPath is the committed AsyncAPI document, generated for a local server.
+const asyncAPIPath = "../asyncapi.yaml"
+
+// TestAsyncAPIDocumentIsUpToDate fails when the Go types of the events and the
+// committed document drift apart.
+func TestAsyncAPIDocumentIsUpToDate(t *testing.T) {
+	doc, err := server.AsyncAPIDocument("http://localhost:8080")
+	require.NoError(t, err)
+	generated, err := doc.YAML()
+	require.NoError(t, err)
+
+	if *updateAsyncAPI {
+		require.NoError(t, os.WriteFile(asyncAPIPath, generated, 0o644))
+	}
+
+	committed, err := os.ReadFile(asyncAPIPath)
+	require.NoError(t, err)
+	require.Equal(t, string(committed), string(generated), "asyncapi.yaml is out of date, regenerate it with: go test ./server -run TestAsyncAPIDocumentIsUpToDate -update-asyncapi")
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"github.com/astroniumm/go-asyncapi/store"
+	"time"
+)
+
+// Dedup policies decide what happens to a report request identical to an
+// earlier one of the same user, see report.Fingerprint.
+const (
+	// DedupOff always creates a new report.
+	DedupOff = "off"
+	// DedupAttach returns the identical report while it is pending or running.
+	DedupAttach = "attach"
+	// DedupReuse also returns an identical report completed within
+	// ReportDedupMaxAge, as long as its output has not expired.
+	DedupReuse = "reuse"
+)
+
+var DedupPolicies = []string{DedupOff, DedupAttach, DedupReuse}
+
+// How a create request was deduplicated, as told in its response.
+const (
+	dedupAttached = "attached"
+	dedupReused   = "reused"
+)
+
+func (s *Server) reportDedup(fingerprint string, now time.Time) store.ReportDedup {
+	dedup := store.ReportDedup{Fingerprint: fingerprint}
+
+	switch s.Config.ReportDedupPolicy {
+	case DedupAttach:
+		dedup.InFlight = true
+	case DedupReuse:
+		completedSince := now.Add(-s.Config.ReportDedupMaxAge)
+		dedup.InFlight = true
+		dedup.CompletedSince = &completedSince
+	}
+
+	return dedup
+}
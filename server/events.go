@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/astroniumm/go-asyncapi/store"
+	"github.com/google/uuid"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	eventsReplayBatchSize = 500
+	eventsKeepAlive       = 15 * time.Second
+	// reportStatusEvent names the server-sent events carrying status transitions
+	reportStatusEvent = "report.status"
+)
+
+type reportEventResponse struct {
+	ReportID  uuid.UUID          `json:"report_id"`
+	Status    store.ReportStatus `json:"status"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+func writeReportEvent(w http.ResponseWriter, event store.ReportEvent) error {
+	data, err := json.Marshal(reportEventResponse{
+		ReportID:  event.ReportID,
+		Status:    event.Status,
+		CreatedAt: event.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, reportStatusEvent, data)
+	return err
+}
+
+// reportEventsHandler streams the status transitions of the caller's reports as
+// server-sent events. Clients resuming with Last-Event-ID first receive the events
+// they missed.
+func (s *Server) reportEventsHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := requestUser(r)
+		if err != nil {
+			return err
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			return NewErrWithStatus(http.StatusInternalServerError, errors.New("streaming is not supported"))
+		}
+
+		var lastEventID int64
+		if header := r.Header.Get("Last-Event-ID"); header != "" {
+			lastEventID, err = strconv.ParseInt(header, 10, 64)
+			if err != nil || lastEventID < 0 {
+				return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("invalid Last-Event-ID %q", header))
+			}
+		}
+
+		// subscribe before replaying so nothing committed in between is lost
+		sub := s.Events.Subscribe(user.ID)
+		defer s.Events.Unsubscribe(sub)
+
+		replayed := map[int64]struct{}{}
+		var missed []store.ReportEvent
+		if lastEventID > 0 {
+			for after := lastEventID; ; {
+				events, err := s.Store.Reports.UserEventsSince(r.Context(), user.ID, after, eventsReplayBatchSize)
+				if err != nil {
+					return NewErrWithStatus(http.StatusInternalServerError, err)
+				}
+				missed = append(missed, events...)
+				if len(events) < eventsReplayBatchSize {
+					break
+				}
+				after = events[len(events)-1].ID
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		if _, err := fmt.Fprint(w, "retry: 3000\n\n"); err != nil {
+			return nil
+		}
+		for _, event := range missed {
+			if err := writeReportEvent(w, event); err != nil {
+				return nil
+			}
+			replayed[event.ID] = struct{}{}
+		}
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(eventsKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return nil
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return nil
+				}
+			case event, ok := <-sub.C:
+				if !ok {
+					// fell behind, the client reconnects and resumes from its last event id
+					return nil
+				}
+				if _, ok := replayed[event.ID]; ok {
+					continue
+				}
+				if err := writeReportEvent(w, event); err != nil {
+					return nil
+				}
+			}
+			flusher.Flush()
+		}
+	})
+}
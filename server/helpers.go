@@ -1,8 +1,11 @@
 package server
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/astroniumm/go-asyncapi/store"
 	"log/slog"
 	"net/http"
 )
@@ -31,7 +34,8 @@ func handler(f func(w http.ResponseWriter, r *http.Request) error) http.HandlerF
 			if e, ok := err.(*ErrWithStatus); ok {
 				status = e.status
 				msg = http.StatusText(e.status)
-				if status == http.StatusBadRequest || status == http.StatusConflict {
+				switch status {
+				case http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity, http.StatusTooManyRequests:
 					msg = e.err.Error()
 				}
 			}
@@ -73,3 +77,19 @@ func decode[T Validator](r *http.Request) (T, error) {
 
 	return t, nil
 }
+
+func requestUser(r *http.Request) (*store.User, error) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		return nil, NewErrWithStatus(http.StatusUnauthorized, errors.New("user is missing from request context"))
+	}
+	return user, nil
+}
+
+// lookupError maps a failed store lookup to 404 when the row does not exist.
+func lookupError(err error) *ErrWithStatus {
+	if errors.Is(err, sql.ErrNoRows) {
+		return NewErrWithStatus(http.StatusNotFound, err)
+	}
+	return NewErrWithStatus(http.StatusInternalServerError, err)
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentRequestBytes = 1 << 20
+)
+
+// idempotent lets clients safely retry a mutating request by sending the same
+// Idempotency-Key header: the first response is recorded and replayed to retries
+// with the same body. Reusing a key for a different request fails with 422.
+// Server errors and rejections by a quota are not recorded, the request can be
+// retried with the same key.
+//
+// Keys are scoped to the signed in user. Anonymous requests, e.g. signups, are
+// scoped by their key and the fingerprint of their body, so a response is only
+// replayed to clients that send the whole body again, password included.
+// Request bodies are only fingerprinted, never stored, but responses are, so
+// routes whose responses carry credentials such as tokens must not be wrapped.
+func (s *Server) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		handler(func(w http.ResponseWriter, r *http.Request) error {
+			return s.serveIdempotent(w, r, key, next)
+		})(w, r)
+	}
+}
+
+func (s *Server) serveIdempotent(w http.ResponseWriter, r *http.Request, key string, next http.HandlerFunc) error {
+	if len(key) > maxIdempotencyKeyLength {
+		return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("%s must not be longer than %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength))
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentRequestBytes+1))
+	if err != nil {
+		return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("reading request body: %w", err))
+	}
+	if len(body) > maxIdempotentRequestBytes {
+		return NewErrWithStatus(http.StatusRequestEntityTooLarge, errors.New("request body is too large"))
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	hash := s.requestFingerprint(r, body)
+	scope := "anonymous:" + hash
+	if user, ok := UserFromContext(r.Context()); ok {
+		scope = user.ID.String()
+	}
+
+	ctx := r.Context()
+	keys := s.Store.IdempotencyKeys
+	if _, err := keys.Acquire(ctx, scope, key, hash, s.Config.IdempotencyLockTimeout, s.Config.IdempotencyKeyTTL); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		existing, err := keys.Find(ctx, scope, key)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		switch {
+		case existing.RequestHash != hash:
+			return NewErrWithStatus(http.StatusUnprocessableEntity, fmt.Errorf("%s was already used for a different request", idempotencyKeyHeader))
+		case existing.CompletedAt == nil:
+			return NewErrWithStatus(http.StatusConflict, fmt.Errorf("a request with this %s is still being processed", idempotencyKeyHeader))
+		}
+
+		if existing.ResponseContentType != nil {
+			w.Header().Set("Content-Type", *existing.ResponseContentType)
+		}
+		w.Header().Set(idempotentReplayedHeader, "true")
+		w.WriteHeader(*existing.ResponseStatus)
+		w.Write(existing.ResponseBody)
+		return nil
+	}
+
+	rec := &recordingWriter{ResponseWriter: w}
+	next(rec, r)
+
+	// the outcome must be recorded even if the client went away
+	ctx = context.WithoutCancel(ctx)
+	if rec.statusCode() >= http.StatusInternalServerError || rec.statusCode() == http.StatusTooManyRequests {
+		if err := keys.Release(ctx, scope, key); err != nil {
+			s.Logger.Error("failed to release idempotency key", "error", err)
+		}
+		return nil
+	}
+	if err := keys.Complete(ctx, scope, key, rec.statusCode(), w.Header().Get("Content-Type"), rec.body.Bytes()); err != nil {
+		s.Logger.Error("failed to record idempotent response", "error", err)
+	}
+
+	return nil
+}
+
+// requestFingerprint identifies a request by its method, path and body. It is
+// keyed with a server secret so stored fingerprints cannot be used to guess
+// the bodies.
+func (s *Server) requestFingerprint(r *http.Request, body []byte) string {
+	h := hmac.New(sha256.New, s.Config.Secret(s.Config.IdempotencySecret, "idempotency"))
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordingWriter passes a response through and keeps a copy of it.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
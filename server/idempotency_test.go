@@ -0,0 +1,67 @@
+package server_test
+
+import (
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+const replayedHeader = "Idempotent-Replayed"
+
+func idempotencyKey(key string) http.Header {
+	return http.Header{"Idempotency-Key": {key}}
+}
+
+func TestIdempotentSignupReplaysResponse(t *testing.T) {
+	env := newAPIEnv(t)
+	key := uuid.NewString()
+	signup := map[string]string{"email": uuid.NewString() + "@example.com", "password": "password"}
+
+	first := env.request(http.MethodPost, "/auth/signup", "", signup, idempotencyKey(key))
+	require.Equal(t, http.StatusCreated, first.Code, first.Body.String())
+	require.Empty(t, first.Header().Get(replayedHeader))
+
+	// a retried signup gets the recorded response instead of a conflict
+	retry := env.request(http.MethodPost, "/auth/signup", "", signup, idempotencyKey(key))
+	require.Equal(t, http.StatusCreated, retry.Code, retry.Body.String())
+	require.Equal(t, "true", retry.Header().Get(replayedHeader))
+	require.Equal(t, first.Body.String(), retry.Body.String())
+
+	// anonymous keys are scoped by the body, a different password is not replayed to
+	other := map[string]string{"email": signup["email"], "password": "guessed"}
+	rec := env.request(http.MethodPost, "/auth/signup", "", other, idempotencyKey(key))
+	require.Equal(t, http.StatusConflict, rec.Code, rec.Body.String())
+	require.Empty(t, rec.Header().Get(replayedHeader))
+
+	rec = env.request(http.MethodPost, "/auth/signup", "", signup, nil)
+	require.Equal(t, http.StatusConflict, rec.Code, rec.Body.String())
+}
+
+func TestIdempotencyKeyReuse(t *testing.T) {
+	env := newAPIEnv(t)
+	owner, ownerToken := env.signUp()
+	recipient, _ := env.signUp()
+	other, _ := env.signUp()
+	shared := env.completedReport(owner)
+	sharesPath := "/reports/" + shared.ID.String() + "/shares"
+	key := uuid.NewString()
+
+	rec := env.request(http.MethodPost, sharesPath, ownerToken, map[string]string{"email": recipient.Email}, idempotencyKey(key))
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+	rec = env.request(http.MethodPost, sharesPath, ownerToken, map[string]string{"email": recipient.Email}, idempotencyKey(key))
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	require.Equal(t, "true", rec.Header().Get(replayedHeader))
+
+	rec = env.request(http.MethodPost, sharesPath, ownerToken, map[string]string{"email": other.Email}, idempotencyKey(key))
+	require.Equal(t, http.StatusUnprocessableEntity, rec.Code, rec.Body.String())
+
+	// keys older than IdempotencyKeyTTL start over
+	_, err := env.db.Exec("UPDATE idempotency_keys SET created_at = created_at - INTERVAL '2 hours' WHERE scope = $1 AND key = $2;", owner.ID.String(), key)
+	require.NoError(t, err)
+
+	rec = env.request(http.MethodPost, sharesPath, ownerToken, map[string]string{"email": other.Email}, idempotencyKey(key))
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	require.Empty(t, rec.Header().Get(replayedHeader))
+}
@@ -2,6 +2,8 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/astroniumm/go-asyncapi/store"
 	"github.com/google/uuid"
 	"log/slog"
@@ -24,55 +26,96 @@ func WithUser(ctx context.Context, user *store.User) context.Context {
 	return context.WithValue(ctx, userCtxKey{}, user)
 }
 
+func UserFromContext(ctx context.Context) (*store.User, bool) {
+	user, ok := ctx.Value(userCtxKey{}).(*store.User)
+	return user, ok && user != nil
+}
+
+// isPublicRoute reports whether the request is served without a bearer token.
+func isPublicRoute(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/auth") {
+		return true
+	}
+	// websocket clients authenticate during the handshake
+	if r.Method == http.MethodGet && r.URL.Path == "/reports/ws" {
+		return true
+	}
+	// download links are authorized by their own signature
+	if (r.Method == http.MethodGet || r.Method == http.MethodHead) && strings.HasPrefix(r.URL.Path, "/reports/") && strings.HasSuffix(r.URL.Path, "/download") {
+		return true
+	}
+	// the AsyncAPI document describes the interface to clients before they sign in
+	if r.URL.Path == "/asyncapi.json" || r.URL.Path == "/asyncapi.yaml" {
+		return true
+	}
+	// public share links are authorized by their token
+	if strings.HasPrefix(r.URL.Path, "/shared/") {
+		return true
+	}
+	return false
+}
+
+var errNotAccessToken = errors.New("not an access token")
+
+// authenticateAccessToken resolves the user an access token was issued to.
+func authenticateAccessToken(ctx context.Context, jwtManager *JwtManager, userStore *store.UsersStore, token string) (*store.User, error) {
+	parsedToken, err := jwtManager.Parse(token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+
+	if !jwtManager.IsAccessToken(parsedToken) {
+		return nil, errNotAccessToken
+	}
+
+	userIdstr, err := parsedToken.Claims.GetSubject()
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract user claim from token: %w", err)
+	}
+
+	userId, err := uuid.Parse(userIdstr)
+	if err != nil {
+		return nil, fmt.Errorf("token subject is invalid: %w", err)
+	}
+
+	user, err := userStore.FindByID(ctx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the user by id: %w", err)
+	}
+
+	return user, nil
+}
+
+func bearerToken(r *http.Request) string {
+	authHeader := r.Header.Get("Authorization")
+	if parts := strings.Split(authHeader, "Bearer "); len(parts) == 2 {
+		return parts[1]
+	}
+	return ""
+}
+
 func NewAuthMiddleware(jwtManager *JwtManager, userStore *store.UsersStore) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if strings.HasPrefix(r.URL.Path, "/auth") {
+			if isPublicRoute(r) {
 				next.ServeHTTP(w, r)
 				return
 			}
 			// auth header check
-			authHeader := r.Header.Get("Authorization")
-			var token string
-			if parts := strings.Split(authHeader, "Bearer "); len(parts) == 2 {
-				token = parts[1]
-			}
+			token := bearerToken(r)
 			if token == "" {
 				w.WriteHeader(http.StatusUnauthorized)
 				return
 			}
 
-			parsedToken, err := jwtManager.Parse(token)
-			if err != nil {
-				slog.Error("failed to parse token", "error", err)
-				w.WriteHeader(http.StatusUnauthorized)
-				return
-			}
-
-			if !jwtManager.IsAccessToken(parsedToken) {
-				w.WriteHeader(http.StatusUnauthorized)
-				w.Write([]byte("not an access token"))
-				return
-			}
-
-			userIdstr, err := parsedToken.Claims.GetSubject()
-			if err != nil {
-				slog.Error("failed to extract user claim from token", "error", err)
-				w.WriteHeader(http.StatusUnauthorized)
-				return
-			}
-
-			userId, err := uuid.Parse(userIdstr)
-			if err != nil {
-				slog.Error("token subject is invalid", "error", err)
-				w.WriteHeader(http.StatusUnauthorized)
-				return
-			}
-
-			user, err := userStore.FindByID(r.Context(), userId)
+			user, err := authenticateAccessToken(r.Context(), jwtManager, userStore, token)
 			if err != nil {
-				slog.Error("failed to get the user by id", "error", err)
 				w.WriteHeader(http.StatusUnauthorized)
+				if errors.Is(err, errNotAccessToken) {
+					w.Write([]byte(err.Error()))
+					return
+				}
+				slog.Error("failed to authenticate request", "error", err)
 				return
 			}
 
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"github.com/astroniumm/go-asyncapi/quota"
+	"net/http"
+	"time"
+)
+
+// quotaLimitResponse shows the usage of one limit, Limit is omitted when the
+// limit is not enforced.
+type quotaLimitResponse struct {
+	Used     int64      `json:"used"`
+	Limit    *int64     `json:"limit,omitempty"`
+	ResetsAt *time.Time `json:"resets_at,omitempty"`
+}
+
+type quotaResponse struct {
+	ConcurrentReports quotaLimitResponse `json:"concurrent_reports"`
+	DailyReports      quotaLimitResponse `json:"daily_reports"`
+	RetainedBytes     quotaLimitResponse `json:"retained_bytes"`
+	Schedules         quotaLimitResponse `json:"schedules"`
+}
+
+func newQuotaLimitResponse(used, limit int64) quotaLimitResponse {
+	resp := quotaLimitResponse{Used: used}
+	if limit > 0 {
+		resp.Limit = &limit
+	}
+	return resp
+}
+
+func (s *Server) getQuotaHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := requestUser(r)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		usage, err := s.Store.Reports.Usage(r.Context(), user.ID, quota.DayStart(now))
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		schedules, err := s.Store.Schedules.Count(r.Context(), user.ID)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		limits := quota.FromConfig(s.Config)
+		resetsAt := quota.DayEnd(now)
+		resp := quotaResponse{
+			ConcurrentReports: newQuotaLimitResponse(usage.ConcurrentReports, limits.MaxConcurrentReports),
+			DailyReports:      newQuotaLimitResponse(usage.DailyReports, limits.MaxDailyReports),
+			RetainedBytes:     newQuotaLimitResponse(usage.RetainedBytes, limits.MaxRetainedBytes),
+			Schedules:         newQuotaLimitResponse(schedules, limits.MaxSchedules),
+		}
+		resp.DailyReports.ResetsAt = &resetsAt
+
+		if err := encode(ServerResponse[quotaResponse]{Data: &resp}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,492 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/astroniumm/go-asyncapi/quota"
+	"github.com/astroniumm/go-asyncapi/report"
+	"github.com/astroniumm/go-asyncapi/storage"
+	"github.com/astroniumm/go-asyncapi/store"
+	"github.com/google/uuid"
+	"math"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+type createReportRequest struct {
+	Window   report.WindowSpec `json:"window"`
+	Type     string            `json:"type"`
+	Params   json.RawMessage   `json:"params"`
+	Format   string            `json:"format"`
+	Gzip     bool              `json:"gzip"`
+	Priority string            `json:"priority"`
+}
+
+type createReportResponse struct {
+	ID uuid.UUID `json:"id"`
+	// Deduplicated tells how an identical report was returned instead of a new one.
+	Deduplicated string `json:"deduplicated,omitempty"`
+}
+
+type reportResponse struct {
+	ID                   uuid.UUID          `json:"id"`
+	Status               store.ReportStatus `json:"status"`
+	Window               windowResponse     `json:"window"`
+	Type                 string             `json:"type"`
+	Params               json.RawMessage    `json:"params"`
+	DownloadUrl          *string            `json:"download_url,omitempty"`
+	DownloadUrlExpiresAt *time.Time         `json:"download_url_expires_at,omitempty"`
+	ErrorMessage         *string            `json:"error_message,omitempty"`
+	CreatedAt            time.Time          `json:"created_at"`
+	StartedAt            *time.Time         `json:"started_at,omitempty"`
+	FailedAt             *time.Time         `json:"failed_at,omitempty"`
+	CompletedAt          *time.Time         `json:"completed_at,omitempty"`
+	DeadLetteredAt       *time.Time         `json:"dead_lettered_at,omitempty"`
+	CancelledAt          *time.Time         `json:"cancelled_at,omitempty"`
+	ExpiredAt            *time.Time         `json:"expired_at,omitempty"`
+	Attempts             int                `json:"attempts"`
+	NextAttemptAt        *time.Time         `json:"next_attempt_at,omitempty"`
+	ScheduleID           *uuid.UUID         `json:"schedule_id,omitempty"`
+	Format               string             `json:"format"`
+	Gzip                 bool               `json:"gzip"`
+	Priority             string             `json:"priority"`
+	Progress             *progressResponse  `json:"progress,omitempty"`
+}
+
+// windowResponse is the time range a report covers, start and end are omitted
+// until a preset has been resolved.
+type windowResponse struct {
+	Start    *time.Time `json:"start,omitempty"`
+	End      *time.Time `json:"end,omitempty"`
+	Timezone string     `json:"timezone"`
+	Preset   *string    `json:"preset,omitempty"`
+}
+
+func newWindowResponse(window *store.ReportWindow) windowResponse {
+	return windowResponse{
+		Start:    window.Start,
+		End:      window.End,
+		Timezone: window.Timezone,
+		Preset:   window.Preset,
+	}
+}
+
+// progressResponse is the last saved progress of a report.
+type progressResponse struct {
+	Percent       float64   `json:"percent"`
+	Stage         string    `json:"stage,omitempty"`
+	RowsProcessed int64     `json:"rows_processed"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func (r createReportRequest) Validate() error {
+	if err := r.Window.Validate(); err != nil {
+		return err
+	}
+	if r.Type == "" {
+		return errors.New("type is required to create a report")
+	}
+	if r.Format != "" {
+		if _, err := report.ParseFormat(r.Format); err != nil {
+			return err
+		}
+	}
+	if r.Priority != "" && !slices.Contains(store.ReportPriorities, r.Priority) {
+		return fmt.Errorf("unknown priority %q, expected one of %v", r.Priority, store.ReportPriorities)
+	}
+	return nil
+}
+
+type reportTypeResponse struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+}
+
+func newReportResponse(report *store.Report) reportResponse {
+	var nextAttemptAt *time.Time
+	if report.Status() == store.ReportStatusPending {
+		nextAttemptAt = &report.NextAttemptAt
+	}
+
+	var progress *progressResponse
+	if report.ProgressUpdatedAt != nil {
+		progress = &progressResponse{UpdatedAt: *report.ProgressUpdatedAt}
+		if report.ProgressPercent != nil {
+			progress.Percent = *report.ProgressPercent
+		}
+		if report.ProgressStage != nil {
+			progress.Stage = *report.ProgressStage
+		}
+		if report.ProgressRows != nil {
+			progress.RowsProcessed = *report.ProgressRows
+		}
+	}
+
+	return reportResponse{
+		ID:                   report.ID,
+		Status:               report.Status(),
+		Window:               newWindowResponse(&report.ReportWindow),
+		Type:                 report.ReportType,
+		Params:               report.Params,
+		DownloadUrl:          report.DownloadUrl,
+		DownloadUrlExpiresAt: report.DownloadUrlExpiresAt,
+		ErrorMessage:         report.ErrorMessage,
+		CreatedAt:            report.CreatedAt,
+		StartedAt:            report.StartedAt,
+		FailedAt:             report.FailedAt,
+		CompletedAt:          report.CompletedAt,
+		DeadLetteredAt:       report.DeadLetteredAt,
+		CancelledAt:          report.CancelledAt,
+		ExpiredAt:            report.ExpiredAt,
+		Attempts:             report.Attempts,
+		NextAttemptAt:        nextAttemptAt,
+		ScheduleID:           report.ScheduleID,
+		Format:               report.Format,
+		Gzip:                 report.Gzip,
+		Priority:             report.Priority,
+		Progress:             progress,
+	}
+}
+
+func (s *Server) createReportHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := requestUser(r)
+		if err != nil {
+			return err
+		}
+
+		req, err := decode[createReportRequest](r)
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		if len(req.Params) == 0 {
+			req.Params = json.RawMessage("{}")
+		}
+		if req.Format == "" {
+			req.Format = string(report.FormatCSV)
+		}
+		if req.Priority == "" {
+			req.Priority = store.ReportPriorityNormal
+		}
+		if err := s.Registry.Validate(req.Type, req.Params); err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		now := time.Now()
+		window, err := storeWindow(req.Window)
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		fingerprint, err := report.Fingerprint(req.Type, req.Params, req.Window, report.Format(req.Format), req.Gzip, now)
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		created, isNew, err := s.Store.Reports.CreateReport(r.Context(), user.ID, window, req.Type, req.Params, req.Priority,
+			store.OutputOptions{Format: req.Format, Gzip: req.Gzip}, s.reportDedup(fingerprint, now), quota.DayStart(now), quota.FromConfig(s.Config).Admit)
+		if err != nil {
+			var exceeded *quota.ExceededError
+			if errors.As(err, &exceeded) {
+				if exceeded.Limit == quota.LimitDailyReports {
+					w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(quota.DayEnd(now).Sub(now).Seconds()))))
+				}
+				return NewErrWithStatus(http.StatusTooManyRequests, err)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		resp := createReportResponse{ID: created.ID}
+		status := http.StatusAccepted
+		switch {
+		case isNew:
+		case created.Status() == store.ReportStatusCompleted:
+			resp.Deduplicated = dedupReused
+			status = http.StatusOK
+		default:
+			resp.Deduplicated = dedupAttached
+		}
+
+		if err := encode(ServerResponse[createReportResponse]{
+			Data: &resp,
+		}, status, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+// storeWindow resolves absolute windows right away, presets are stored as they
+// are and resolved when the report runs.
+func storeWindow(spec report.WindowSpec) (store.ReportWindow, error) {
+	if spec.Preset != "" {
+		loc, err := spec.Location()
+		if err != nil {
+			return store.ReportWindow{}, err
+		}
+		return store.ReportWindow{Timezone: loc.String(), Preset: &spec.Preset}, nil
+	}
+
+	window, err := spec.Resolve(time.Time{})
+	if err != nil {
+		return store.ReportWindow{}, err
+	}
+	return store.ReportWindow{Start: &window.Start, End: &window.End, Timezone: window.Timezone}, nil
+}
+
+func (s *Server) getReportHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := requestUser(r)
+		if err != nil {
+			return err
+		}
+
+		reportID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("invalid report id: %w", err))
+		}
+
+		report, err := s.Store.Reports.ByPrimaryKey(r.Context(), user.ID, reportID)
+		if errors.Is(err, sql.ErrNoRows) {
+			// recipients of a share have read-only access to the report
+			report, err = s.Store.ReportShares.SharedReport(r.Context(), user.ID, reportID)
+		}
+		if err != nil {
+			return lookupError(err)
+		}
+
+		if err := s.ensureDownloadUrl(r.Context(), report); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		resp := newReportResponse(report)
+		if err := encode(ServerResponse[reportResponse]{
+			Data: &resp,
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *Server) listReportsHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := requestUser(r)
+		if err != nil {
+			return err
+		}
+
+		reports, err := s.Store.Reports.ListByUser(r.Context(), user.ID)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		resp := make([]reportResponse, 0, len(reports))
+		for i := range reports {
+			if err := s.ensureDownloadUrl(r.Context(), &reports[i]); err != nil {
+				return NewErrWithStatus(http.StatusInternalServerError, err)
+			}
+			resp = append(resp, newReportResponse(&reports[i]))
+		}
+
+		if err := encode(ServerResponse[[]reportResponse]{
+			Data: &resp,
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *Server) listReportTypesHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		generators := s.Registry.Generators()
+
+		resp := make([]reportTypeResponse, 0, len(generators))
+		for _, generator := range generators {
+			resp = append(resp, reportTypeResponse{
+				Name:   generator.Name(),
+				Schema: generator.Schema(),
+			})
+		}
+
+		if err := encode(ServerResponse[[]reportTypeResponse]{
+			Data: &resp,
+		}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *Server) requeueReportHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := requestUser(r)
+		if err != nil {
+			return err
+		}
+
+		reportID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("invalid report id: %w", err))
+		}
+
+		report, err := s.Store.Reports.ByPrimaryKey(r.Context(), user.ID, reportID)
+		if err != nil {
+			return lookupError(err)
+		}
+		if report.Status() != store.ReportStatusDead {
+			return NewErrWithStatus(http.StatusConflict, fmt.Errorf("only dead reports can be requeued, report is %s", report.Status()))
+		}
+
+		report, err = s.Store.Reports.RequeueReport(r.Context(), user.ID, reportID)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, sql.ErrNoRows) {
+				// requeued concurrently
+				status = http.StatusConflict
+			}
+			return NewErrWithStatus(status, err)
+		}
+
+		resp := newReportResponse(report)
+		if err := encode(ServerResponse[reportResponse]{
+			Data: &resp,
+		}, http.StatusAccepted, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+// cancelReportHandler cancels a pending report right away. Running reports are
+// marked as cancelled too and stopped by the worker that runs them.
+func (s *Server) cancelReportHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := requestUser(r)
+		if err != nil {
+			return err
+		}
+
+		reportID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("invalid report id: %w", err))
+		}
+
+		report, err := s.Store.Reports.CancelReport(r.Context(), user.ID, reportID)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusInternalServerError, err)
+			}
+
+			existing, err := s.Store.Reports.ByPrimaryKey(r.Context(), user.ID, reportID)
+			if err != nil {
+				return lookupError(err)
+			}
+			return NewErrWithStatus(http.StatusConflict, fmt.Errorf("report is already %s", existing.Status()))
+		}
+
+		resp := newReportResponse(report)
+		if err := encode(ServerResponse[reportResponse]{
+			Data: &resp,
+		}, http.StatusAccepted, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+// ensureDownloadUrl mints a fresh signed download URL for a completed report
+// whose URL is missing or about to expire.
+func (s *Server) ensureDownloadUrl(ctx context.Context, report *store.Report) error {
+	if report.Status() != store.ReportStatusCompleted || report.OutputFilePath == nil {
+		return nil
+	}
+
+	now := time.Now()
+	if report.DownloadUrl != nil && report.DownloadUrlExpiresAt != nil && report.DownloadUrlExpiresAt.After(now.Add(time.Minute)) {
+		return nil
+	}
+
+	downloadUrl, expiresAt := s.Downloads.Sign(report.ID, now)
+	if err := s.Store.Reports.SetDownloadUrl(ctx, report.UserID, report.ID, downloadUrl, expiresAt); err != nil {
+		return err
+	}
+	report.DownloadUrl = &downloadUrl
+	report.DownloadUrlExpiresAt = &expiresAt
+
+	return nil
+}
+
+func (s *Server) downloadReportHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		reportID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("invalid report id: %w", err))
+		}
+
+		query := r.URL.Query()
+		if err := s.Downloads.Verify(reportID, query.Get("expires"), query.Get("signature"), time.Now()); err != nil {
+			return NewErrWithStatus(http.StatusForbidden, err)
+		}
+
+		report, err := s.Store.Reports.FindByID(r.Context(), reportID)
+		if err != nil {
+			return lookupError(err)
+		}
+		if report.Status() == store.ReportStatusExpired {
+			return NewErrWithStatus(http.StatusGone, fmt.Errorf("output of report %s has expired", reportID))
+		}
+		if report.Status() != store.ReportStatusCompleted || report.OutputFilePath == nil {
+			return NewErrWithStatus(http.StatusNotFound, fmt.Errorf("report %s has no output", reportID))
+		}
+
+		return s.serveReportOutput(w, r, report)
+	})
+}
+
+// serveReportOutput streams the stored output of a report, honouring Range and
+// If-Range headers so interrupted downloads can be resumed.
+func (s *Server) serveReportOutput(w http.ResponseWriter, r *http.Request, report *store.Report) error {
+	info, err := s.Blob.Stat(r.Context(), *report.OutputFilePath)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, storage.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		return NewErrWithStatus(status, err)
+	}
+
+	object, err := s.Blob.Get(r.Context(), *report.OutputFilePath)
+	if err != nil {
+		return NewErrWithStatus(http.StatusInternalServerError, err)
+	}
+	defer object.Close()
+
+	filename := "report-" + report.ID.String()
+	if report.OutputFileExtension != nil {
+		filename += *report.OutputFileExtension
+	}
+	if report.OutputContentType != nil {
+		w.Header().Set("Content-Type", *report.OutputContentType)
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	// outputs never change once written, so the report id is a stable validator for If-Range
+	w.Header().Set("ETag", `"`+report.ID.String()+`"`)
+	http.ServeContent(w, r, filename, info.ModTime, object)
+
+	return nil
+}
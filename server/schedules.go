@@ -0,0 +1,226 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/astroniumm/go-asyncapi/quota"
+	"github.com/astroniumm/go-asyncapi/report"
+	"github.com/astroniumm/go-asyncapi/schedule"
+	"github.com/astroniumm/go-asyncapi/store"
+	"github.com/google/uuid"
+	"net/http"
+	"slices"
+	"time"
+)
+
+type createScheduleRequest struct {
+	Cron          string          `json:"cron"`
+	Timezone      string          `json:"timezone"`
+	Type          string          `json:"type"`
+	Params        json.RawMessage `json:"params"`
+	MisfirePolicy string          `json:"misfire_policy"`
+	WindowPreset  string          `json:"window_preset"`
+	Format        string          `json:"format"`
+	Gzip          bool            `json:"gzip"`
+}
+
+func (r createScheduleRequest) Validate() error {
+	if r.Cron == "" {
+		return errors.New("cron is required to create a schedule")
+	}
+	if r.Type == "" {
+		return errors.New("type is required to create a schedule")
+	}
+	if r.MisfirePolicy != "" && !slices.Contains(schedule.MisfirePolicies, r.MisfirePolicy) {
+		return fmt.Errorf("unknown misfire_policy %q, expected one of %v", r.MisfirePolicy, schedule.MisfirePolicies)
+	}
+	if r.WindowPreset != "" && !slices.Contains(report.Presets, r.WindowPreset) {
+		return fmt.Errorf("unknown window_preset %q, expected one of %v", r.WindowPreset, report.Presets)
+	}
+	if r.Format != "" {
+		if _, err := report.ParseFormat(r.Format); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type scheduleResponse struct {
+	ID            uuid.UUID       `json:"id"`
+	Cron          string          `json:"cron"`
+	Timezone      string          `json:"timezone"`
+	Type          string          `json:"type"`
+	Params        json.RawMessage `json:"params"`
+	MisfirePolicy string          `json:"misfire_policy"`
+	NextRunAt     time.Time       `json:"next_run_at"`
+	LastRunAt     *time.Time      `json:"last_run_at,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	WindowPreset  string          `json:"window_preset"`
+	Format        string          `json:"format"`
+	Gzip          bool            `json:"gzip"`
+	// DisabledAt is set once the schedule stopped firing, DisabledReason says why.
+	DisabledAt     *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason *string    `json:"disabled_reason,omitempty"`
+}
+
+func newScheduleResponse(schedule *store.ReportSchedule) scheduleResponse {
+	return scheduleResponse{
+		ID:             schedule.ID,
+		Cron:           schedule.CronExpr,
+		Timezone:       schedule.Timezone,
+		Type:           schedule.ReportType,
+		Params:         schedule.Params,
+		MisfirePolicy:  schedule.MisfirePolicy,
+		NextRunAt:      schedule.NextRunAt,
+		LastRunAt:      schedule.LastRunAt,
+		CreatedAt:      schedule.CreatedAt,
+		WindowPreset:   schedule.WindowPreset,
+		Format:         schedule.Format,
+		Gzip:           schedule.Gzip,
+		DisabledAt:     schedule.DisabledAt,
+		DisabledReason: schedule.DisabledReason,
+	}
+}
+
+func scheduleID(r *http.Request) (uuid.UUID, error) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		return uuid.Nil, NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("invalid schedule id: %w", err))
+	}
+	return id, nil
+}
+
+func (s *Server) createScheduleHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := requestUser(r)
+		if err != nil {
+			return err
+		}
+
+		req, err := decode[createScheduleRequest](r)
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+		if req.Timezone == "" {
+			req.Timezone = "UTC"
+		}
+		if req.MisfirePolicy == "" {
+			req.MisfirePolicy = schedule.MisfireRunOnce
+		}
+		if len(req.Params) == 0 {
+			req.Params = json.RawMessage("{}")
+		}
+		if req.WindowPreset == "" {
+			req.WindowPreset = report.PresetLast24Hours
+		}
+		if req.Format == "" {
+			req.Format = string(report.FormatCSV)
+		}
+
+		cronSchedule, err := schedule.Parse(req.Cron, req.Timezone)
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+		if err := s.Registry.Validate(req.Type, req.Params); err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		created, err := s.Store.Schedules.Create(r.Context(), user.ID, store.ScheduleParams{
+			CronExpr:      req.Cron,
+			Timezone:      req.Timezone,
+			ReportType:    req.Type,
+			Params:        req.Params,
+			MisfirePolicy: req.MisfirePolicy,
+			NextRunAt:     cronSchedule.Next(time.Now()),
+			WindowPreset:  req.WindowPreset,
+			Output:        store.OutputOptions{Format: req.Format, Gzip: req.Gzip},
+		}, quota.FromConfig(s.Config).AdmitSchedule)
+		if err != nil {
+			var exceeded *quota.ExceededError
+			if errors.As(err, &exceeded) {
+				return NewErrWithStatus(http.StatusTooManyRequests, err)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		resp := newScheduleResponse(created)
+		if err := encode(ServerResponse[scheduleResponse]{Data: &resp}, http.StatusCreated, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *Server) listSchedulesHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := requestUser(r)
+		if err != nil {
+			return err
+		}
+
+		schedules, err := s.Store.Schedules.ListByUser(r.Context(), user.ID)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		resp := make([]scheduleResponse, 0, len(schedules))
+		for i := range schedules {
+			resp = append(resp, newScheduleResponse(&schedules[i]))
+		}
+
+		if err := encode(ServerResponse[[]scheduleResponse]{Data: &resp}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *Server) getScheduleHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := requestUser(r)
+		if err != nil {
+			return err
+		}
+
+		id, err := scheduleID(r)
+		if err != nil {
+			return err
+		}
+
+		found, err := s.Store.Schedules.ByPrimaryKey(r.Context(), user.ID, id)
+		if err != nil {
+			return lookupError(err)
+		}
+
+		resp := newScheduleResponse(found)
+		if err := encode(ServerResponse[scheduleResponse]{Data: &resp}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *Server) deleteScheduleHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := requestUser(r)
+		if err != nil {
+			return err
+		}
+
+		id, err := scheduleID(r)
+		if err != nil {
+			return err
+		}
+
+		if err := s.Store.Schedules.Delete(r.Context(), user.ID, id); err != nil {
+			return lookupError(err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
@@ -2,12 +2,17 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/astroniumm/go-asyncapi/config"
+	"github.com/astroniumm/go-asyncapi/download"
+	"github.com/astroniumm/go-asyncapi/events"
+	"github.com/astroniumm/go-asyncapi/report"
+	"github.com/astroniumm/go-asyncapi/storage"
 	"github.com/astroniumm/go-asyncapi/store"
 	"log/slog"
 	"net"
 	"net/http"
-	"sync"
 	"time"
 )
 
@@ -16,14 +21,22 @@ type Server struct {
 	Logger     *slog.Logger
 	Store      *store.Store
 	JwtManager *JwtManager
+	Registry   *report.Registry
+	Blob       storage.Blob
+	Downloads  *download.Signer
+	Events     *events.Hub
 }
 
-func NewServer(config *config.Config, logger *slog.Logger, store *store.Store, jwtManager *JwtManager) *Server {
+func NewServer(config *config.Config, logger *slog.Logger, store *store.Store, jwtManager *JwtManager, registry *report.Registry, blob storage.Blob, downloads *download.Signer, events *events.Hub) *Server {
 	return &Server{
 		Config:     config,
 		Logger:     logger,
 		Store:      store,
 		JwtManager: jwtManager,
+		Registry:   registry,
+		Blob:       blob,
+		Downloads:  downloads,
+		Events:     events,
 	}
 }
 
@@ -35,40 +48,74 @@ func (s *Server) Ping(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *Server) Run(ctx context.Context) error {
+// Handler routes requests to the handlers of the API, behind authentication.
+func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /ping", s.Ping)
-	mux.HandleFunc("POST /auth/signup", s.SignUpHandler())
+	mux.HandleFunc("GET /asyncapi.json", s.asyncAPIHandler(false))
+	mux.HandleFunc("GET /asyncapi.yaml", s.asyncAPIHandler(true))
+	mux.HandleFunc("POST /auth/signup", s.idempotent(s.SignUpHandler()))
 	mux.HandleFunc("POST /auth/signin", s.SignInHandler())
 	mux.HandleFunc("POST /auth/refresh", s.tokenRefreshHandler())
+	mux.HandleFunc("GET /me/quota", s.getQuotaHandler())
+	mux.HandleFunc("GET /report-types", s.listReportTypesHandler())
+	mux.HandleFunc("POST /reports", s.idempotent(s.createReportHandler()))
+	mux.HandleFunc("GET /reports", s.listReportsHandler())
+	mux.HandleFunc("GET /reports/events", s.reportEventsHandler())
+	mux.HandleFunc("GET /reports/ws", s.reportsWebSocketHandler())
+	mux.HandleFunc("GET /reports/shared", s.listSharedReportsHandler())
+	mux.HandleFunc("GET /reports/{id}", s.getReportHandler())
+	mux.HandleFunc("GET /reports/{id}/download", s.downloadReportHandler())
+	mux.HandleFunc("POST /reports/{id}/requeue", s.idempotent(s.requeueReportHandler()))
+	mux.HandleFunc("POST /reports/{id}/cancel", s.idempotent(s.cancelReportHandler()))
+	mux.HandleFunc("POST /reports/{id}/shares", s.idempotent(s.shareReportHandler()))
+	mux.HandleFunc("GET /reports/{id}/shares", s.listReportSharesHandler())
+	mux.HandleFunc("DELETE /reports/{id}/shares/{user_id}", s.idempotent(s.unshareReportHandler()))
+	mux.HandleFunc("POST /reports/{id}/links", s.idempotent(s.createShareLinkHandler()))
+	mux.HandleFunc("GET /reports/{id}/links", s.listShareLinksHandler())
+	mux.HandleFunc("DELETE /reports/{id}/links/{link_id}", s.idempotent(s.revokeShareLinkHandler()))
+	mux.HandleFunc("GET /shared/{token}", s.getSharedLinkHandler())
+	mux.HandleFunc("GET /shared/{token}/download", s.downloadSharedLinkHandler())
+	mux.HandleFunc("POST /schedules", s.idempotent(s.createScheduleHandler()))
+	mux.HandleFunc("GET /schedules", s.listSchedulesHandler())
+	mux.HandleFunc("GET /schedules/{id}", s.getScheduleHandler())
+	mux.HandleFunc("DELETE /schedules/{id}", s.idempotent(s.deleteScheduleHandler()))
+	mux.HandleFunc("POST /webhooks", s.idempotent(s.createWebhookHandler()))
+	mux.HandleFunc("GET /webhooks", s.listWebhooksHandler())
+	mux.HandleFunc("DELETE /webhooks/{id}", s.idempotent(s.deleteWebhookHandler()))
+	mux.HandleFunc("GET /webhooks/{id}/deliveries", s.listWebhookDeliveriesHandler())
 
 	middleware := NewLoggerMiddleware(s.Logger)
 	middleware = NewAuthMiddleware(s.JwtManager, s.Store.Users)
+	return middleware(mux)
+}
+
+func (s *Server) Run(ctx context.Context) error {
 	server := &http.Server{
 		Addr:    net.JoinHostPort(s.Config.ServerHost, s.Config.ServerPort),
-		Handler: middleware(mux),
+		Handler: s.Handler(),
 	}
 
+	listenErr := make(chan error, 1)
 	go func() {
 		s.Logger.Info("server is running", "port", s.Config.ServerPort)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			s.Logger.Error("server refused to listen and serve")
-		}
+		listenErr <- server.ListenAndServe()
 	}()
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		<-ctx.Done()
-
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := server.Shutdown(shutdownCtx); err != nil {
-			s.Logger.Error("apiserver failed to shutdown")
+	select {
+	case err := <-listenErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
 		}
-	}()
-	wg.Wait()
+		return fmt.Errorf("server refused to listen and serve: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("apiserver failed to shutdown: %w", err)
+	}
 
-	return server.ListenAndServe()
+	return nil
 }
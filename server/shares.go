@@ -0,0 +1,497 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/astroniumm/go-asyncapi/store"
+	"github.com/google/uuid"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// shareTokenPrefix makes share link tokens recognizable, e.g. in secret scanners.
+	shareTokenPrefix = "shr_"
+	// maxShareLinkTTL bounds links to reports whose outputs are kept forever.
+	maxShareLinkTTL = 365 * 24 * time.Hour
+)
+
+type shareReportRequest struct {
+	Email string `json:"email"`
+}
+
+func (r shareReportRequest) Validate() error {
+	if strings.TrimSpace(r.Email) == "" {
+		return errors.New("email is required to share a report")
+	}
+	return nil
+}
+
+type reportShareResponse struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type createShareLinkRequest struct {
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	MaxDownloads *int       `json:"max_downloads,omitempty"`
+}
+
+func (r createShareLinkRequest) Validate() error {
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(time.Now()) {
+		return errors.New("expires_at must be in the future")
+	}
+	if r.ExpiresAt != nil && r.ExpiresAt.After(time.Now().Add(maxShareLinkTTL)) {
+		return fmt.Errorf("expires_at must be within %s", maxShareLinkTTL)
+	}
+	if r.MaxDownloads != nil && *r.MaxDownloads < 1 {
+		return errors.New("max_downloads must be at least 1")
+	}
+	return nil
+}
+
+type shareLinkResponse struct {
+	ID           uuid.UUID  `json:"id"`
+	ReportID     uuid.UUID  `json:"report_id"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	MaxDownloads *int       `json:"max_downloads,omitempty"`
+	Downloads    int        `json:"downloads"`
+	Active       bool       `json:"active"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	// Token and Url are only returned when the link is created
+	Token string `json:"token,omitempty"`
+	Url   string `json:"url,omitempty"`
+}
+
+// sharedReportResponse describes a report reached through a public share link.
+// It leaves out everything but what is needed to download the output.
+type sharedReportResponse struct {
+	ReportID           uuid.UUID      `json:"report_id"`
+	Type               string         `json:"type"`
+	Window             windowResponse `json:"window"`
+	CompletedAt        *time.Time     `json:"completed_at,omitempty"`
+	ExpiresAt          time.Time      `json:"expires_at"`
+	RemainingDownloads *int           `json:"remaining_downloads,omitempty"`
+	DownloadUrl        string         `json:"download_url"`
+}
+
+func newReportShareResponse(share *store.ReportShare) reportShareResponse {
+	return reportShareResponse{
+		UserID:    share.UserID,
+		Email:     share.Email,
+		CreatedAt: share.CreatedAt,
+	}
+}
+
+func newShareLinkResponse(link *store.ReportShareLink) shareLinkResponse {
+	return shareLinkResponse{
+		ID:           link.ID,
+		ReportID:     link.ReportID,
+		ExpiresAt:    link.ExpiresAt,
+		MaxDownloads: link.MaxDownloads,
+		Downloads:    link.Downloads,
+		Active:       link.Active(time.Now()),
+		RevokedAt:    link.RevokedAt,
+		CreatedAt:    link.CreatedAt,
+	}
+}
+
+// newShareToken returns a random share link token and the hash it is stored as.
+func newShareToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate share token: %w", err)
+	}
+	token := shareTokenPrefix + hex.EncodeToString(b)
+	return token, hashShareToken(token), nil
+}
+
+func hashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Server) shareLinkUrl(token string) string {
+	return s.Downloads.BaseURL() + "/shared/" + token
+}
+
+func reportID(r *http.Request) (uuid.UUID, error) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		return uuid.Nil, NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("invalid report id: %w", err))
+	}
+	return id, nil
+}
+
+// ownedReport loads a report of the requesting user. Only owners manage the
+// shares and links of a report, so recipients get a 404 like anybody else.
+func (s *Server) ownedReport(r *http.Request) (*store.User, *store.Report, error) {
+	user, err := requestUser(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	id, err := reportID(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report, err := s.Store.Reports.ByPrimaryKey(r.Context(), user.ID, id)
+	if err != nil {
+		return nil, nil, lookupError(err)
+	}
+
+	return user, report, nil
+}
+
+// shareReportHandler shares a report with the user signed up with an email. It
+// answers the same whether or not somebody signed up with the email, so it
+// cannot be used to find out who has an account.
+func (s *Server) shareReportHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, report, err := s.ownedReport(r)
+		if err != nil {
+			return err
+		}
+
+		req, err := decode[shareReportRequest](r)
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		recipient, err := s.Store.Users.FindByEmail(r.Context(), strings.TrimSpace(req.Email))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+		if recipient != nil && recipient.ID == user.ID {
+			return NewErrWithStatus(http.StatusBadRequest, errors.New("a report cannot be shared with its owner"))
+		}
+
+		if recipient != nil {
+			if _, err := s.Store.ReportShares.Share(r.Context(), user.ID, report.ID, recipient.ID); err != nil {
+				return NewErrWithStatus(http.StatusInternalServerError, err)
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+func (s *Server) listReportSharesHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, report, err := s.ownedReport(r)
+		if err != nil {
+			return err
+		}
+
+		shares, err := s.Store.ReportShares.ListByReport(r.Context(), user.ID, report.ID)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		resp := make([]reportShareResponse, 0, len(shares))
+		for i := range shares {
+			resp = append(resp, newReportShareResponse(&shares[i]))
+		}
+
+		if err := encode(ServerResponse[[]reportShareResponse]{Data: &resp}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *Server) unshareReportHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, report, err := s.ownedReport(r)
+		if err != nil {
+			return err
+		}
+
+		recipientID, err := uuid.Parse(r.PathValue("user_id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("invalid user id: %w", err))
+		}
+
+		if err := s.Store.ReportShares.Unshare(r.Context(), user.ID, report.ID, recipientID); err != nil {
+			return lookupError(err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+// listSharedReportsHandler returns the reports other users shared with the
+// requesting user.
+func (s *Server) listSharedReportsHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := requestUser(r)
+		if err != nil {
+			return err
+		}
+
+		reports, err := s.Store.ReportShares.ListSharedWith(r.Context(), user.ID)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		resp := make([]reportResponse, 0, len(reports))
+		for i := range reports {
+			if err := s.ensureDownloadUrl(r.Context(), &reports[i]); err != nil {
+				return NewErrWithStatus(http.StatusInternalServerError, err)
+			}
+			resp = append(resp, newReportResponse(&reports[i]))
+		}
+
+		if err := encode(ServerResponse[[]reportResponse]{Data: &resp}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *Server) createShareLinkHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, report, err := s.ownedReport(r)
+		if err != nil {
+			return err
+		}
+
+		req, err := decode[createShareLinkRequest](r)
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+
+		if report.Status() != store.ReportStatusCompleted || report.OutputFilePath == nil {
+			return NewErrWithStatus(http.StatusConflict, fmt.Errorf("report %s is %s, only completed reports can be shared through a link", report.ID, report.Status()))
+		}
+
+		expiresAt := time.Now().Add(min(s.Config.ShareLinkTTL, maxShareLinkTTL))
+		if req.ExpiresAt != nil {
+			expiresAt = *req.ExpiresAt
+		}
+		// a link must not outlive the output it points at
+		if outputExpiresAt, ok := s.outputExpiresAt(report); ok && expiresAt.After(outputExpiresAt) {
+			if req.ExpiresAt != nil {
+				return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("expires_at must not be after %s, when the output of the report expires", outputExpiresAt.Format(time.RFC3339)))
+			}
+			expiresAt = outputExpiresAt
+		}
+
+		token, tokenHash, err := newShareToken()
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		link, err := s.Store.ReportShares.CreateLink(r.Context(), user.ID, report.ID, tokenHash, expiresAt, req.MaxDownloads)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		resp := newShareLinkResponse(link)
+		resp.Token = token
+		resp.Url = s.shareLinkUrl(token)
+		if err := encode(ServerResponse[shareLinkResponse]{Data: &resp}, http.StatusCreated, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+// outputExpiresAt is when the janitor deletes the output of a completed report,
+// false when outputs of its type are kept forever.
+func (s *Server) outputExpiresAt(report *store.Report) (time.Time, bool) {
+	retention, ok := s.Config.ReportRetentionByType[report.ReportType]
+	if !ok {
+		retention = s.Config.ReportRetention
+	}
+	if retention <= 0 || report.CompletedAt == nil {
+		return time.Time{}, false
+	}
+	return report.CompletedAt.Add(retention), true
+}
+
+func (s *Server) listShareLinksHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, report, err := s.ownedReport(r)
+		if err != nil {
+			return err
+		}
+
+		links, err := s.Store.ReportShares.ListLinks(r.Context(), user.ID, report.ID)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		resp := make([]shareLinkResponse, 0, len(links))
+		for i := range links {
+			resp = append(resp, newShareLinkResponse(&links[i]))
+		}
+
+		if err := encode(ServerResponse[[]shareLinkResponse]{Data: &resp}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *Server) revokeShareLinkHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, report, err := s.ownedReport(r)
+		if err != nil {
+			return err
+		}
+
+		linkID, err := uuid.Parse(r.PathValue("link_id"))
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("invalid share link id: %w", err))
+		}
+
+		if _, err := s.Store.ReportShares.RevokeLink(r.Context(), user.ID, report.ID, linkID); err != nil {
+			return lookupError(err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+// sharedLink resolves the token of a public share link to the link and its
+// report. Links that can no longer be used and reports whose output is gone
+// answer 410, unknown tokens 404.
+func (s *Server) sharedLink(r *http.Request) (*store.ReportShareLink, *store.Report, error) {
+	link, err := s.Store.ReportShares.FindLink(r.Context(), hashShareToken(r.PathValue("token")))
+	if err != nil {
+		return nil, nil, lookupError(err)
+	}
+	if !link.Active(time.Now()) {
+		return nil, nil, NewErrWithStatus(http.StatusGone, fmt.Errorf("share link %s is no longer active", link.ID))
+	}
+
+	report, err := s.Store.Reports.ByPrimaryKey(r.Context(), link.OwnerID, link.ReportID)
+	if err != nil {
+		return nil, nil, lookupError(err)
+	}
+	if report.Status() != store.ReportStatusCompleted || report.OutputFilePath == nil {
+		return nil, nil, NewErrWithStatus(http.StatusGone, fmt.Errorf("output of report %s is no longer available", report.ID))
+	}
+
+	return link, report, nil
+}
+
+func (s *Server) getSharedLinkHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		link, report, err := s.sharedLink(r)
+		if err != nil {
+			return err
+		}
+
+		var remaining *int
+		if link.MaxDownloads != nil {
+			n := *link.MaxDownloads - link.Downloads
+			remaining = &n
+		}
+
+		resp := sharedReportResponse{
+			ReportID:           report.ID,
+			Type:               report.ReportType,
+			Window:             newWindowResponse(&report.ReportWindow),
+			CompletedAt:        report.CompletedAt,
+			ExpiresAt:          link.ExpiresAt,
+			RemainingDownloads: remaining,
+			DownloadUrl:        s.shareLinkUrl(r.PathValue("token")) + "/download",
+		}
+		if err := encode(ServerResponse[sharedReportResponse]{Data: &resp}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+// downloadSharedLinkHandler streams the output of a report shared through a
+// public link. Only GET requests that download the whole output count against
+// the download limit: a download is counted up front and given back unless the
+// output was served in full. Links with a limit always serve the whole output,
+// ranges would let clients download it piece by piece without being counted.
+func (s *Server) downloadSharedLinkHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		link, report, err := s.sharedLink(r)
+		if err != nil {
+			return err
+		}
+
+		if link.MaxDownloads != nil {
+			r.Header.Del("Range")
+		}
+		if r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+			return s.serveReportOutput(w, r, report)
+		}
+
+		// the limit is enforced atomically, concurrent downloads may have used up the link
+		if _, err := s.Store.ReportShares.ConsumeLink(r.Context(), link.TokenHash); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewErrWithStatus(http.StatusGone, err)
+			}
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		cw := &completionWriter{ResponseWriter: w}
+		serveErr := s.serveReportOutput(cw, r, report)
+		if !cw.complete() {
+			// e.g. answered 304 to a conditional request or the client went away
+			if err := s.Store.ReportShares.ReleaseLink(context.WithoutCancel(r.Context()), link.ID); err != nil {
+				s.Logger.Error("failed to release share link download", "error", err, "link_id", link.ID)
+			}
+		}
+		return serveErr
+	})
+}
+
+// completionWriter tells whether a response was a 200 whose body was written in
+// full, according to its Content-Length.
+type completionWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+	failed  bool
+}
+
+func (w *completionWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *completionWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	if err != nil {
+		w.failed = true
+	}
+	return n, err
+}
+
+func (w *completionWriter) complete() bool {
+	length, err := strconv.ParseInt(w.Header().Get("Content-Length"), 10, 64)
+	return w.status == http.StatusOK && !w.failed && err == nil && w.written == length
+}
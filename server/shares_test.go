@@ -0,0 +1,231 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/astroniumm/go-asyncapi/config"
+	"github.com/astroniumm/go-asyncapi/download"
+	"github.com/astroniumm/go-asyncapi/report"
+	"github.com/astroniumm/go-asyncapi/server"
+	"github.com/astroniumm/go-asyncapi/storage"
+	"github.com/astroniumm/go-asyncapi/store"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sharedOutput = "id,email\n"
+
+// apiEnv serves the API against the database in TEST_DB_URL, which has to be
+// migrated, e.g. with make db_migrate. Every test signs up its own users.
+type apiEnv struct {
+	t       *testing.T
+	db      *sql.DB
+	store   *store.Store
+	jwt     *server.JwtManager
+	blob    storage.Blob
+	handler http.Handler
+}
+
+func newAPIEnv(t *testing.T) *apiEnv {
+	dsn := os.Getenv("TEST_DB_URL")
+	if dsn == "" {
+		t.Skip("TEST_DB_URL is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	conf := testConfig()
+	conf.Env = config.Env_Test
+	conf.ShareLinkTTL = time.Hour
+	conf.ReportRetention = 24 * time.Hour
+	conf.DownloadUrlTTL = time.Hour
+	conf.IdempotencyKeyTTL = time.Hour
+	conf.IdempotencyLockTimeout = time.Minute
+
+	blob, err := storage.NewLocalBlob(t.TempDir())
+	require.NoError(t, err)
+
+	dataStore := store.New(db)
+	jwt := server.NewJWTManager(conf)
+	srv := server.NewServer(conf, slog.New(slog.NewTextHandler(io.Discard, nil)), dataStore, jwt, report.NewRegistry(), blob, download.NewSigner(conf), nil)
+
+	return &apiEnv{t: t, db: db, store: dataStore, jwt: jwt, blob: blob, handler: srv.Handler()}
+}
+
+// signUp creates a user and returns it with an access token.
+func (e *apiEnv) signUp() (*store.User, string) {
+	user, err := e.store.Users.CreateUser(context.Background(), uuid.NewString()+"@example.com", "password")
+	require.NoError(e.t, err)
+	tokens, err := e.jwt.GenerateTokenPair(user.ID)
+	require.NoError(e.t, err)
+	return user, tokens.AccessToken.Raw
+}
+
+func (e *apiEnv) completedReport(owner *store.User) *store.Report {
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+	created, _, err := e.store.Reports.CreateReport(ctx, owner.ID, store.ReportWindow{Start: &start, End: &end, Timezone: "UTC"},
+		"signups", json.RawMessage("{}"), store.ReportPriorityNormal, store.OutputOptions{Format: string(report.FormatCSV)},
+		store.ReportDedup{}, time.Now(), nil)
+	require.NoError(e.t, err)
+
+	// run the report the way a worker does
+	const worker = "test-worker"
+	_, err = e.store.Reports.ClaimNext(ctx, worker, time.Minute, time.Now(), func(candidates []store.QueueCandidate) []store.QueueCandidate {
+		for _, candidate := range candidates {
+			if candidate.ID == created.ID {
+				return []store.QueueCandidate{candidate}
+			}
+		}
+		return nil
+	})
+	require.NoError(e.t, err)
+
+	key := "reports/" + created.ID.String() + ".csv"
+	require.NoError(e.t, e.blob.Put(ctx, key, strings.NewReader(sharedOutput)))
+	require.NoError(e.t, e.store.Reports.SetOutput(ctx, owner.ID, created.ID, worker, key, int64(len(sharedOutput)), "text/csv", ".csv"))
+	completed, err := e.store.Reports.CompleteReport(ctx, owner.ID, created.ID, worker)
+	require.NoError(e.t, err)
+	return completed
+}
+
+func (e *apiEnv) request(method, path, token string, body any, header http.Header) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		require.NoError(e.t, err)
+		reader = bytes.NewReader(b)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	e.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+type createdShareLink struct {
+	Data struct {
+		ID    uuid.UUID `json:"id"`
+		Token string    `json:"token"`
+	} `json:"data"`
+}
+
+func (e *apiEnv) createLink(reportID uuid.UUID, token string, body map[string]any) createdShareLink {
+	rec := e.request(http.MethodPost, "/reports/"+reportID.String()+"/links", token, body, nil)
+	require.Equal(e.t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	var link createdShareLink
+	require.NoError(e.t, json.Unmarshal(rec.Body.Bytes(), &link))
+	return link
+}
+
+func TestShareReportGrantsReadAccess(t *testing.T) {
+	env := newAPIEnv(t)
+	owner, ownerToken := env.signUp()
+	recipient, recipientToken := env.signUp()
+	_, strangerToken := env.signUp()
+	shared := env.completedReport(owner)
+	reportPath := "/reports/" + shared.ID.String()
+
+	require.Equal(t, http.StatusNotFound, env.request(http.MethodGet, reportPath, recipientToken, nil, nil).Code)
+
+	rec := env.request(http.MethodPost, reportPath+"/shares", ownerToken, map[string]string{"email": recipient.Email}, nil)
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	require.Equal(t, http.StatusOK, env.request(http.MethodGet, reportPath, recipientToken, nil, nil).Code)
+	require.Equal(t, http.StatusNotFound, env.request(http.MethodGet, reportPath, strangerToken, nil, nil).Code)
+
+	// unknown emails get the same answer, nothing is shared
+	rec = env.request(http.MethodPost, reportPath+"/shares", ownerToken, map[string]string{"email": uuid.NewString() + "@example.com"}, nil)
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+	// recipients cannot manage the shares of the report
+	require.Equal(t, http.StatusNotFound, env.request(http.MethodGet, reportPath+"/shares", recipientToken, nil, nil).Code)
+
+	rec = env.request(http.MethodDelete, reportPath+"/shares/"+recipient.ID.String(), ownerToken, nil, nil)
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	require.Equal(t, http.StatusNotFound, env.request(http.MethodGet, reportPath, recipientToken, nil, nil).Code)
+}
+
+func TestShareLinkRevocation(t *testing.T) {
+	env := newAPIEnv(t)
+	owner, ownerToken := env.signUp()
+	shared := env.completedReport(owner)
+	link := env.createLink(shared.ID, ownerToken, nil)
+
+	require.Equal(t, http.StatusOK, env.request(http.MethodGet, "/shared/"+link.Data.Token, "", nil, nil).Code)
+
+	rec := env.request(http.MethodDelete, "/reports/"+shared.ID.String()+"/links/"+link.Data.ID.String(), ownerToken, nil, nil)
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+	require.Equal(t, http.StatusGone, env.request(http.MethodGet, "/shared/"+link.Data.Token, "", nil, nil).Code)
+	require.Equal(t, http.StatusGone, env.request(http.MethodGet, "/shared/"+link.Data.Token+"/download", "", nil, nil).Code)
+	require.Equal(t, http.StatusNotFound, env.request(http.MethodGet, "/shared/shr_unknown", "", nil, nil).Code)
+}
+
+func TestShareLinkExpiry(t *testing.T) {
+	env := newAPIEnv(t)
+	owner, ownerToken := env.signUp()
+	shared := env.completedReport(owner)
+
+	// links cannot outlive the output of the report
+	rec := env.request(http.MethodPost, "/reports/"+shared.ID.String()+"/links", ownerToken,
+		map[string]any{"expires_at": time.Now().Add(48 * time.Hour)}, nil)
+	require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+
+	link := env.createLink(shared.ID, ownerToken, map[string]any{"expires_at": time.Now().Add(time.Hour)})
+	require.Equal(t, http.StatusOK, env.request(http.MethodGet, "/shared/"+link.Data.Token, "", nil, nil).Code)
+
+	_, err := env.db.Exec("UPDATE report_share_links SET expires_at = CURRENT_TIMESTAMP - INTERVAL '1 second' WHERE id = $1;", link.Data.ID)
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusGone, env.request(http.MethodGet, "/shared/"+link.Data.Token, "", nil, nil).Code)
+	require.Equal(t, http.StatusGone, env.request(http.MethodGet, "/shared/"+link.Data.Token+"/download", "", nil, nil).Code)
+}
+
+func TestShareLinkDownloadLimit(t *testing.T) {
+	env := newAPIEnv(t)
+	owner, ownerToken := env.signUp()
+	shared := env.completedReport(owner)
+	link := env.createLink(shared.ID, ownerToken, map[string]any{"max_downloads": 2})
+	downloadPath := "/shared/" + link.Data.Token + "/download"
+
+	// neither HEAD requests nor unchanged conditional requests count
+	require.Equal(t, http.StatusOK, env.request(http.MethodHead, downloadPath, "", nil, nil).Code)
+	rec := env.request(http.MethodGet, downloadPath, "", nil, http.Header{"If-None-Match": {`"` + shared.ID.String() + `"`}})
+	require.Equal(t, http.StatusNotModified, rec.Code)
+
+	// ranges are ignored, the whole output is served and counted
+	rec = env.request(http.MethodGet, downloadPath, "", nil, http.Header{"Range": {"bytes=0-1"}})
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, sharedOutput, rec.Body.String())
+
+	rec = env.request(http.MethodGet, downloadPath, "", nil, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, sharedOutput, rec.Body.String())
+
+	require.Equal(t, http.StatusGone, env.request(http.MethodGet, downloadPath, "", nil, nil).Code)
+
+	links, err := env.store.ReportShares.ListLinks(context.Background(), owner.ID, shared.ID)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	require.Equal(t, 2, links[0].Downloads)
+	require.False(t, links[0].Active(time.Now()))
+}
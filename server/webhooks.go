@@ -0,0 +1,223 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"github.com/astroniumm/go-asyncapi/store"
+	"github.com/astroniumm/go-asyncapi/webhook"
+	"github.com/google/uuid"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 500
+)
+
+type createWebhookRequest struct {
+	Url    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+func (r createWebhookRequest) Validate() error {
+	if r.Url == "" {
+		return errors.New("url is required to create a webhook")
+	}
+	// the url itself is checked by webhook.CheckURL, whose rules depend on the environment
+	for _, event := range r.Events {
+		if !slices.Contains(store.WebhookEvents, event) {
+			return fmt.Errorf("unknown webhook event %q, expected one of %v", event, store.WebhookEvents)
+		}
+	}
+	return nil
+}
+
+type webhookResponse struct {
+	ID        uuid.UUID `json:"id"`
+	Url       string    `json:"url"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+	// Secret is only returned when the webhook is created
+	Secret string `json:"secret,omitempty"`
+}
+
+type webhookDeliveryResponse struct {
+	ID             int64      `json:"id"`
+	ReportID       uuid.UUID  `json:"report_id"`
+	Event          string     `json:"event"`
+	Attempts       int        `json:"attempts"`
+	ResponseStatus *int       `json:"response_status,omitempty"`
+	LastError      *string    `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	FailedAt       *time.Time `json:"failed_at,omitempty"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+func newWebhookResponse(webhook *store.Webhook) webhookResponse {
+	return webhookResponse{
+		ID:        webhook.ID,
+		Url:       webhook.Url,
+		Events:    webhook.Events,
+		CreatedAt: webhook.CreatedAt,
+	}
+}
+
+func newWebhookDeliveryResponse(delivery *store.WebhookDelivery) webhookDeliveryResponse {
+	var nextAttemptAt *time.Time
+	if delivery.DeliveredAt == nil && delivery.FailedAt == nil {
+		nextAttemptAt = &delivery.NextAttemptAt
+	}
+
+	return webhookDeliveryResponse{
+		ID:             delivery.ID,
+		ReportID:       delivery.ReportID,
+		Event:          delivery.Event,
+		Attempts:       delivery.Attempts,
+		ResponseStatus: delivery.ResponseStatus,
+		LastError:      delivery.LastError,
+		DeliveredAt:    delivery.DeliveredAt,
+		FailedAt:       delivery.FailedAt,
+		NextAttemptAt:  nextAttemptAt,
+		CreatedAt:      delivery.CreatedAt,
+	}
+}
+
+func webhookID(r *http.Request) (uuid.UUID, error) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		return uuid.Nil, NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("invalid webhook id: %w", err))
+	}
+	return id, nil
+}
+
+func (s *Server) createWebhookHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := requestUser(r)
+		if err != nil {
+			return err
+		}
+
+		req, err := decode[createWebhookRequest](r)
+		if err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+		// deliveries are checked again once the host name is resolved
+		if err := webhook.CheckURL(req.Url, webhook.AllowsPrivateTargets(s.Config)); err != nil {
+			return NewErrWithStatus(http.StatusBadRequest, err)
+		}
+		if len(req.Events) == 0 {
+			req.Events = store.WebhookEvents
+		}
+
+		secret, err := webhook.NewSecret()
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		created, err := s.Store.Webhooks.Create(r.Context(), user.ID, req.Url, secret, req.Events)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		resp := newWebhookResponse(created)
+		resp.Secret = created.Secret
+		if err := encode(ServerResponse[webhookResponse]{Data: &resp}, http.StatusCreated, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *Server) listWebhooksHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := requestUser(r)
+		if err != nil {
+			return err
+		}
+
+		webhooks, err := s.Store.Webhooks.ListByUser(r.Context(), user.ID)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		resp := make([]webhookResponse, 0, len(webhooks))
+		for i := range webhooks {
+			resp = append(resp, newWebhookResponse(&webhooks[i]))
+		}
+
+		if err := encode(ServerResponse[[]webhookResponse]{Data: &resp}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *Server) deleteWebhookHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := requestUser(r)
+		if err != nil {
+			return err
+		}
+
+		id, err := webhookID(r)
+		if err != nil {
+			return err
+		}
+
+		if err := s.Store.Webhooks.Delete(r.Context(), user.ID, id); err != nil {
+			return lookupError(err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+// listWebhookDeliveriesHandler returns the delivery log of a webhook, newest first.
+func (s *Server) listWebhookDeliveriesHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := requestUser(r)
+		if err != nil {
+			return err
+		}
+
+		id, err := webhookID(r)
+		if err != nil {
+			return err
+		}
+
+		limit := defaultDeliveriesLimit
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			limit, err = strconv.Atoi(raw)
+			if err != nil || limit < 1 || limit > maxDeliveriesLimit {
+				return NewErrWithStatus(http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxDeliveriesLimit))
+			}
+		}
+
+		if _, err := s.Store.Webhooks.ByPrimaryKey(r.Context(), user.ID, id); err != nil {
+			return lookupError(err)
+		}
+
+		deliveries, err := s.Store.Webhooks.ListDeliveries(r.Context(), user.ID, id, limit)
+		if err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		resp := make([]webhookDeliveryResponse, 0, len(deliveries))
+		for i := range deliveries {
+			resp = append(resp, newWebhookDeliveryResponse(&deliveries[i]))
+		}
+
+		if err := encode(ServerResponse[[]webhookDeliveryResponse]{Data: &resp}, http.StatusOK, w); err != nil {
+			return NewErrWithStatus(http.StatusInternalServerError, err)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/astroniumm/go-asyncapi/events"
+	"github.com/astroniumm/go-asyncapi/store"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"time"
+)
+
+const (
+	wsWriteWait          = 10 * time.Second
+	wsPongWait           = 60 * time.Second
+	wsPingPeriod         = wsPongWait * 9 / 10
+	wsMaxMessageSize     = 4096
+	wsMaxSubscriptions   = 100
+	wsMessageSubscribe   = "subscribe"
+	wsMessageUnsubscribe = "unsubscribe"
+	wsMessageStatus      = "status"
+	wsMessageProgress    = "progress"
+	wsMessageError       = "error"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// wsClientMessage is sent by clients to change the set of reports they follow:
+//
+//	{"type": "subscribe", "report_ids": ["..."]}
+//	{"type": "unsubscribe", "report_ids": ["..."]}
+type wsClientMessage struct {
+	Type      string      `json:"type"`
+	ReportIDs []uuid.UUID `json:"report_ids"`
+}
+
+// wsServerMessage is sent to clients. Status messages carry the current status
+// right after subscribing and every transition afterwards, progress messages
+// report how far a running report has got.
+type wsServerMessage struct {
+	Type     string             `json:"type"`
+	ReportID *uuid.UUID         `json:"report_id,omitempty"`
+	EventID  int64              `json:"event_id,omitempty"`
+	Status   store.ReportStatus `json:"status,omitempty"`
+	Progress *events.Progress   `json:"progress,omitempty"`
+	Error    string             `json:"error,omitempty"`
+}
+
+func wsError(format string, args ...any) wsServerMessage {
+	return wsServerMessage{Type: wsMessageError, Error: fmt.Sprintf(format, args...)}
+}
+
+// reportsWebSocketHandler lets clients follow a set of their reports over a single
+// connection. Browsers cannot set headers on the handshake, so the access token is
+// also accepted in the access_token query parameter.
+func (s *Server) reportsWebSocketHandler() http.HandlerFunc {
+	return handler(func(w http.ResponseWriter, r *http.Request) error {
+		token := bearerToken(r)
+		if token == "" {
+			token = r.URL.Query().Get("access_token")
+		}
+		if token == "" {
+			return NewErrWithStatus(http.StatusUnauthorized, errors.New("missing access token"))
+		}
+
+		user, err := authenticateAccessToken(r.Context(), s.JwtManager, s.Store.Users, token)
+		if err != nil {
+			return NewErrWithStatus(http.StatusUnauthorized, err)
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// the upgrader has already replied with an error
+			s.Logger.Warn("websocket upgrade failed", "error", err)
+			return nil
+		}
+		defer conn.Close()
+
+		s.serveReportsWebSocket(r.Context(), conn, user)
+		return nil
+	})
+}
+
+func (s *Server) serveReportsWebSocket(ctx context.Context, conn *websocket.Conn, user *store.User) {
+	sub := s.Events.Subscribe(user.ID)
+	defer s.Events.Unsubscribe(sub)
+
+	done := make(chan struct{})
+	defer close(done)
+
+	incoming := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		conn.SetReadLimit(wsMaxMessageSize)
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		})
+
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case incoming <- data:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	write := func(msg wsServerMessage) error {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		return conn.WriteJSON(msg)
+	}
+
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+
+	subscribed := map[uuid.UUID]struct{}{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-readErr:
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				s.Logger.Warn("websocket closed unexpectedly", "error", err, "user_id", user.ID)
+			}
+			return
+		case data := <-incoming:
+			for _, reply := range s.handleWebSocketMessage(ctx, user, data, subscribed) {
+				if err := write(reply); err != nil {
+					return
+				}
+			}
+		case event, ok := <-sub.C:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "subscriber fell behind"),
+					time.Now().Add(wsWriteWait))
+				return
+			}
+			if _, ok := subscribed[event.ReportID]; !ok {
+				continue
+			}
+			if err := write(wsServerMessage{
+				Type:     wsMessageStatus,
+				ReportID: &event.ReportID,
+				EventID:  event.ID,
+				Status:   event.Status,
+			}); err != nil {
+				return
+			}
+		case progress := <-sub.Progress:
+			if _, ok := subscribed[progress.ReportID]; !ok {
+				continue
+			}
+			if err := write(wsServerMessage{
+				Type:     wsMessageProgress,
+				ReportID: &progress.ReportID,
+				Progress: &progress,
+			}); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) handleWebSocketMessage(ctx context.Context, user *store.User, data []byte, subscribed map[uuid.UUID]struct{}) []wsServerMessage {
+	var msg wsClientMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return []wsServerMessage{wsError("invalid message: %v", err)}
+	}
+
+	var replies []wsServerMessage
+	switch msg.Type {
+	case wsMessageSubscribe:
+		for _, reportID := range msg.ReportIDs {
+			if _, ok := subscribed[reportID]; ok {
+				continue
+			}
+			if len(subscribed) >= wsMaxSubscriptions {
+				replies = append(replies, wsError("cannot subscribe to more than %d reports", wsMaxSubscriptions))
+				break
+			}
+
+			report, err := s.Store.Reports.ByPrimaryKey(ctx, user.ID, reportID)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					replies = append(replies, wsError("report %s not found", reportID))
+				} else {
+					s.Logger.Error("failed to look up subscribed report", "error", err, "report_id", reportID)
+					replies = append(replies, wsError("failed to subscribe to report %s", reportID))
+				}
+				continue
+			}
+
+			subscribed[reportID] = struct{}{}
+			replies = append(replies, wsServerMessage{
+				Type:     wsMessageStatus,
+				ReportID: &report.ID,
+				Status:   report.Status(),
+			})
+		}
+	case wsMessageUnsubscribe:
+		for _, reportID := range msg.ReportIDs {
+			delete(subscribed, reportID)
+		}
+	default:
+		replies = append(replies, wsError("unknown message type %q", msg.Type))
+	}
+
+	return replies
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/astroniumm/go-asyncapi/config"
+	"io"
+	"time"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Blob stores report outputs under slash separated keys.
+type Blob interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get opens the object for reading. The returned reader supports seeking so
+	// callers can serve byte ranges without downloading the whole object.
+	Get(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+}
+
+type Driver string
+
+const (
+	Driver_Local Driver = "local"
+	Driver_S3    Driver = "s3"
+)
+
+// New returns the Blob driver selected by config.StorageDriver.
+func New(config *config.Config) (Blob, error) {
+	switch Driver(config.StorageDriver) {
+	case Driver_Local:
+		return NewLocalBlob(config.ReportOutputDir)
+	case Driver_S3:
+		return NewS3Blob(S3Options{
+			Endpoint:        config.S3Endpoint,
+			Bucket:          config.S3Bucket,
+			Region:          config.S3Region,
+			AccessKeyID:     config.S3AccessKeyID,
+			SecretAccessKey: config.S3SecretAccessKey,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", config.StorageDriver)
+	}
+}
@@ -0,0 +1,163 @@
+package storage_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/astroniumm/go-asyncapi/storage"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a minimal in-process S3-compatible server for path-style requests.
+type fakeS3 struct {
+	t       *testing.T
+	bucket  string
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3(t *testing.T, bucket string) *httptest.Server {
+	fake := &fakeS3{t: t, bucket: bucket, objects: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+f.bucket+"/")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		require.NoError(f.t, err)
+		sum := sha256.Sum256(body)
+		if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `<Error><Code>XAmzContentSHA256Mismatch</Code><Message>bad hash</Message></Error>`)
+			return
+		}
+		f.objects[key] = body
+	case http.MethodHead, http.MethodGet:
+		body, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		start := 0
+		if rng := r.Header.Get("Range"); rng != "" {
+			start, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)-start))
+		if start > 0 {
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		if r.Method == http.MethodGet {
+			w.Write(body[start:])
+		}
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func testBlob(t *testing.T, blob storage.Blob) {
+	ctx := context.Background()
+	const key = "user/report"
+
+	require.NoError(t, blob.Put(ctx, key, strings.NewReader("hello world")))
+
+	info, err := blob.Stat(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, int64(11), info.Size)
+
+	object, err := blob.Get(ctx, key)
+	require.NoError(t, err)
+	content, err := io.ReadAll(object)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(content))
+
+	offset, err := object.Seek(6, io.SeekStart)
+	require.NoError(t, err)
+	require.Equal(t, int64(6), offset)
+	content, err = io.ReadAll(object)
+	require.NoError(t, err)
+	require.Equal(t, "world", string(content))
+
+	_, err = object.Seek(-11, io.SeekEnd)
+	require.NoError(t, err)
+	head := make([]byte, 5)
+	_, err = io.ReadFull(object, head)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(head))
+	require.NoError(t, object.Close())
+
+	require.NoError(t, blob.Put(ctx, key, strings.NewReader("replaced")))
+	info, err = blob.Stat(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, int64(8), info.Size)
+
+	require.NoError(t, blob.Delete(ctx, key))
+	require.NoError(t, blob.Delete(ctx, key))
+
+	_, err = blob.Stat(ctx, key)
+	require.True(t, errors.Is(err, storage.ErrNotFound))
+	_, err = blob.Get(ctx, key)
+	require.True(t, errors.Is(err, storage.ErrNotFound))
+}
+
+func TestLocalBlob(t *testing.T) {
+	blob, err := storage.NewLocalBlob(t.TempDir())
+	require.NoError(t, err)
+
+	testBlob(t, blob)
+
+	_, err = blob.Stat(context.Background(), "/")
+	require.Error(t, err)
+}
+
+func TestS3Blob(t *testing.T) {
+	server := newFakeS3(t, "reports")
+
+	blob, err := storage.NewS3Blob(storage.S3Options{
+		Endpoint:        server.URL,
+		Bucket:          "reports",
+		AccessKeyID:     "test-key",
+		SecretAccessKey: "test-secret",
+	})
+	require.NoError(t, err)
+
+	testBlob(t, blob)
+
+	unauthorized, err := storage.NewS3Blob(storage.S3Options{
+		Endpoint:        server.URL,
+		Bucket:          "reports",
+		AccessKeyID:     "other-key",
+		SecretAccessKey: "test-secret",
+	})
+	require.NoError(t, err)
+	require.Error(t, unauthorized.Put(context.Background(), "user/report", strings.NewReader("x")))
+}
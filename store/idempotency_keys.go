@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+type IdempotencyKeysStore struct {
+	db *sqlx.DB
+}
+
+func NewIdempotencyKeysStore(db *sql.DB) *IdempotencyKeysStore {
+	return &IdempotencyKeysStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+// IdempotencyKey remembers the response to a request sent with an Idempotency-Key
+// header, so retries of the request get the same response.
+type IdempotencyKey struct {
+	Scope               string     `db:"scope"`
+	Key                 string     `db:"key"`
+	RequestHash         string     `db:"request_hash"`
+	ResponseStatus      *int       `db:"response_status"`
+	ResponseContentType *string    `db:"response_content_type"`
+	ResponseBody        []byte     `db:"response_body"`
+	LockedAt            time.Time  `db:"locked_at"`
+	CompletedAt         *time.Time `db:"completed_at"`
+	CreatedAt           time.Time  `db:"created_at"`
+}
+
+// Acquire claims a key for a request. Keys whose request never completed are
+// taken over once lockTimeout has passed, keys older than ttl are started over.
+// When the key is held by another request or already completed, sql.ErrNoRows
+// is returned and Find tells which.
+func (s *IdempotencyKeysStore) Acquire(ctx context.Context, scope, key, requestHash string, lockTimeout, ttl time.Duration) (*IdempotencyKey, error) {
+	const query = `INSERT INTO idempotency_keys (scope, key, request_hash) VALUES ($1, $2, $3)
+ON CONFLICT (scope, key) DO UPDATE SET request_hash = EXCLUDED.request_hash, locked_at = CURRENT_TIMESTAMP,
+	response_status = NULL, response_content_type = NULL, response_body = NULL, completed_at = NULL,
+	created_at = CASE WHEN idempotency_keys.created_at < CURRENT_TIMESTAMP - $5 * INTERVAL '1 millisecond'
+		THEN CURRENT_TIMESTAMP ELSE idempotency_keys.created_at END
+WHERE idempotency_keys.created_at < CURRENT_TIMESTAMP - $5 * INTERVAL '1 millisecond'
+	OR (idempotency_keys.completed_at IS NULL AND idempotency_keys.request_hash = $3
+		AND idempotency_keys.locked_at < CURRENT_TIMESTAMP - $4 * INTERVAL '1 millisecond')
+RETURNING *;`
+
+	var idempotencyKey IdempotencyKey
+	if err := s.db.GetContext(ctx, &idempotencyKey, query, scope, key, requestHash, lockTimeout.Milliseconds(), ttl.Milliseconds()); err != nil {
+		return nil, fmt.Errorf("failed to acquire idempotency key %q: %w", key, err)
+	}
+
+	return &idempotencyKey, nil
+}
+
+func (s *IdempotencyKeysStore) Find(ctx context.Context, scope, key string) (*IdempotencyKey, error) {
+	const query = "SELECT * FROM idempotency_keys WHERE scope = $1 AND key = $2;"
+
+	var idempotencyKey IdempotencyKey
+	if err := s.db.GetContext(ctx, &idempotencyKey, query, scope, key); err != nil {
+		return nil, fmt.Errorf("failed to get idempotency key %q: %w", key, err)
+	}
+
+	return &idempotencyKey, nil
+}
+
+// Complete records the response to replay for a key.
+func (s *IdempotencyKeysStore) Complete(ctx context.Context, scope, key string, status int, contentType string, body []byte) error {
+	const query = `UPDATE idempotency_keys SET response_status = $3, response_content_type = $4, response_body = $5,
+	completed_at = CURRENT_TIMESTAMP
+WHERE scope = $1 AND key = $2;`
+
+	if _, err := s.db.ExecContext(ctx, query, scope, key, status, contentType, body); err != nil {
+		return fmt.Errorf("failed to complete idempotency key %q: %w", key, err)
+	}
+
+	return nil
+}
+
+// Release forgets a key whose request failed, so it can be retried.
+func (s *IdempotencyKeysStore) Release(ctx context.Context, scope, key string) error {
+	const query = "DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2 AND completed_at IS NULL;"
+
+	if _, err := s.db.ExecContext(ctx, query, scope, key); err != nil {
+		return fmt.Errorf("failed to release idempotency key %q: %w", key, err)
+	}
+
+	return nil
+}
+
+// DeleteCreatedBefore removes keys that are too old to be replayed and returns how many.
+func (s *IdempotencyKeysStore) DeleteCreatedBefore(ctx context.Context, before time.Time) (int64, error) {
+	const query = "DELETE FROM idempotency_keys WHERE created_at < $1;"
+
+	res, err := s.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete idempotency keys: %w", err)
+	}
+
+	return res.RowsAffected()
+}
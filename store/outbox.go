@@ -0,0 +1,156 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"slices"
+	"time"
+)
+
+// Aggregates whose changes are published through the outbox.
+const (
+	OutboxAggregateUser   = "user"
+	OutboxAggregateReport = "report"
+)
+
+// OutboxEventUserCreated is published when a user signs up. Report status
+// transitions are published as "report.<status>", see ReportOutboxEvent.
+const OutboxEventUserCreated = "user.created"
+
+// ReportOutboxEvent is the outbox event type of a report entering status.
+func ReportOutboxEvent(status ReportStatus) string {
+	return "report." + string(status)
+}
+
+// OutboxMessage is a domain event recorded in the same transaction as the change
+// it describes, waiting to be published by the relay.
+type OutboxMessage struct {
+	ID            int64           `db:"id"`
+	AggregateType string          `db:"aggregate_type"`
+	AggregateID   uuid.UUID       `db:"aggregate_id"`
+	EventType     string          `db:"event_type"`
+	Payload       json.RawMessage `db:"payload"`
+	Attempts      int             `db:"attempts"`
+	NextAttemptAt time.Time       `db:"next_attempt_at"`
+	LastError     *string         `db:"last_error"`
+	PublishedAt   *time.Time      `db:"published_at"`
+	CreatedAt     time.Time       `db:"created_at"`
+}
+
+// UserCreated is the outbox payload of OutboxEventUserCreated.
+type UserCreated struct {
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReportStatusChanged is the outbox payload of report status transitions.
+type ReportStatusChanged struct {
+	EventID    int64              `json:"event_id"`
+	UserID     uuid.UUID          `json:"user_id"`
+	OccurredAt time.Time          `json:"occurred_at"`
+	Report     ReportStatusChange `json:"report"`
+}
+
+type OutboxStore struct {
+	db *sqlx.DB
+}
+
+func NewOutboxStore(db *sql.DB) *OutboxStore {
+	return &OutboxStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+// insertOutbox records an event in the transaction of the change it describes
+// and wakes the relay once the transaction commits.
+func insertOutbox(ctx context.Context, tx *sqlx.Tx, aggregateType string, aggregateID uuid.UUID, eventType string, payload any) error {
+	const query = "INSERT INTO outbox (aggregate_type, aggregate_id, event_type, payload) VALUES ($1, $2, $3, $4);"
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s outbox payload: %w", eventType, err)
+	}
+	if _, err := tx.ExecContext(ctx, query, aggregateType, aggregateID, eventType, string(b)); err != nil {
+		return fmt.Errorf("failed to record %s in the outbox: %w", eventType, err)
+	}
+
+	return notify(ctx, tx, ChannelOutbox, "")
+}
+
+// Claim leases the oldest unpublished message of up to limit aggregates whose
+// turn has come, oldest first. Later messages of an aggregate are only claimed
+// once the ones before have been published, so every aggregate is published in
+// order. Claimed messages are due again when the lease runs out, in case their
+// outcome is never recorded.
+func (s *OutboxStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error) {
+	const query = `WITH heads AS (
+	SELECT DISTINCT ON (aggregate_type, aggregate_id) id, next_attempt_at FROM outbox
+	WHERE published_at IS NULL
+	ORDER BY aggregate_type, aggregate_id, id
+), due AS (
+	SELECT id FROM outbox
+	WHERE id IN (SELECT id FROM heads WHERE next_attempt_at <= CURRENT_TIMESTAMP)
+	ORDER BY id
+	LIMIT $1
+	FOR UPDATE SKIP LOCKED
+)
+UPDATE outbox SET attempts = attempts + 1, next_attempt_at = CURRENT_TIMESTAMP + $2 * INTERVAL '1 millisecond'
+FROM due WHERE outbox.id = due.id
+RETURNING outbox.*;`
+
+	messages := []OutboxMessage{}
+	if err := s.db.SelectContext(ctx, &messages, query, limit, lease.Milliseconds()); err != nil {
+		return nil, fmt.Errorf("failed to claim outbox messages: %w", err)
+	}
+	slices.SortFunc(messages, func(a, b OutboxMessage) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return messages, nil
+}
+
+func (s *OutboxStore) MarkPublished(ctx context.Context, id int64) error {
+	const query = "UPDATE outbox SET published_at = CURRENT_TIMESTAMP, last_error = NULL WHERE id = $1;"
+
+	if _, err := s.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to mark outbox message %d as published: %w", id, err)
+	}
+
+	return nil
+}
+
+// Retry records a failed publication, the message is due again at nextAttemptAt.
+func (s *OutboxStore) Retry(ctx context.Context, id int64, lastError string, nextAttemptAt time.Time) error {
+	const query = "UPDATE outbox SET last_error = $2, next_attempt_at = $3 WHERE id = $1 AND published_at IS NULL;"
+
+	if _, err := s.db.ExecContext(ctx, query, id, lastError, nextAttemptAt); err != nil {
+		return fmt.Errorf("failed to schedule retry of outbox message %d: %w", id, err)
+	}
+
+	return nil
+}
+
+// DeletePublished deletes up to limit messages published before the given time
+// and returns how many were deleted.
+func (s *OutboxStore) DeletePublished(ctx context.Context, before time.Time, limit int) (int64, error) {
+	const query = `DELETE FROM outbox WHERE id IN (
+	SELECT id FROM outbox WHERE published_at < $1 LIMIT $2
+);`
+
+	res, err := s.db.ExecContext(ctx, query, before, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete published outbox messages: %w", err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count deleted outbox messages: %w", err)
+	}
+
+	return deleted, nil
+}
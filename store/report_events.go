@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"strconv"
+	"time"
+)
+
+// Notification channels emitted when reports change, delivered once the
+// transaction commits.
+const (
+	// ChannelReportsQueue is notified when a report becomes pending.
+	ChannelReportsQueue = "reports_queue"
+	// ChannelReportEvents is notified with the id of every new report event.
+	ChannelReportEvents = "report_events"
+	// ChannelReportCancelled is notified with the id of every cancelled report.
+	ChannelReportCancelled = "report_cancelled"
+	// ChannelWebhookDeliveries is notified when webhook deliveries are queued.
+	ChannelWebhookDeliveries = "webhook_deliveries"
+	// ChannelReportProgress is notified with a ReportProgress as JSON whenever
+	// the progress of a running report is saved.
+	ChannelReportProgress = "report_progress"
+	// ChannelOutbox is notified when messages are added to the outbox.
+	ChannelOutbox = "outbox"
+)
+
+// ReportEvent records a status transition of a report. Ids are increasing, so
+// clients can resume a stream of events from the last id they have seen.
+type ReportEvent struct {
+	ID        int64        `db:"id"`
+	UserID    uuid.UUID    `db:"user_id"`
+	ReportID  uuid.UUID    `db:"report_id"`
+	Status    ReportStatus `db:"status"`
+	CreatedAt time.Time    `db:"created_at"`
+}
+
+// transition runs a status changing statement returning the report row,
+// records the resulting status as a report event, queues the webhook deliveries
+// and the outbox message it triggers and notifies listeners, all in the same
+// transaction.
+func (s *ReportsStore) transition(ctx context.Context, report *Report, query string, args ...any) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := transitionTx(ctx, tx, report, query, args...); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit report transition: %w", err)
+	}
+	return nil
+}
+
+// transitionTx is transition within a transaction of the caller.
+func transitionTx(ctx context.Context, tx *sqlx.Tx, report *Report, query string, args ...any) error {
+	if err := tx.GetContext(ctx, report, query, args...); err != nil {
+		return err
+	}
+	event, err := insertReportEvent(ctx, tx, report)
+	if err != nil {
+		return err
+	}
+
+	queued, err := enqueueWebhookDeliveries(ctx, tx, report, event)
+	if err != nil {
+		return err
+	}
+
+	if err := insertOutbox(ctx, tx, OutboxAggregateReport, report.ID, ReportOutboxEvent(event.Status), ReportStatusChanged{
+		EventID:    event.ID,
+		UserID:     report.UserID,
+		OccurredAt: event.CreatedAt,
+		Report: ReportStatusChange{
+			ID:           report.ID,
+			Type:         report.ReportType,
+			Status:       event.Status,
+			ErrorMessage: report.ErrorMessage,
+		},
+	}); err != nil {
+		return err
+	}
+
+	if err := notify(ctx, tx, ChannelReportEvents, strconv.FormatInt(event.ID, 10)); err != nil {
+		return err
+	}
+	if queued > 0 {
+		if err := notify(ctx, tx, ChannelWebhookDeliveries, ""); err != nil {
+			return err
+		}
+	}
+	switch report.Status() {
+	case ReportStatusPending:
+		if err := notify(ctx, tx, ChannelReportsQueue, report.ID.String()); err != nil {
+			return err
+		}
+	case ReportStatusCancelled:
+		if err := notify(ctx, tx, ChannelReportCancelled, report.ID.String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func insertReportEvent(ctx context.Context, tx *sqlx.Tx, report *Report) (*ReportEvent, error) {
+	const query = "INSERT INTO report_events (user_id, report_id, status) VALUES ($1, $2, $3) RETURNING *;"
+
+	var event ReportEvent
+	if err := tx.GetContext(ctx, &event, query, report.UserID, report.ID, report.Status()); err != nil {
+		return nil, fmt.Errorf("failed to record report event: %w", err)
+	}
+
+	return &event, nil
+}
+
+func notify(ctx context.Context, tx *sqlx.Tx, channel, payload string) error {
+	if _, err := tx.ExecContext(ctx, "SELECT pg_notify($1, $2);", channel, payload); err != nil {
+		return fmt.Errorf("failed to notify %s: %w", channel, err)
+	}
+	return nil
+}
+
+func (s *ReportsStore) LatestEventID(ctx context.Context) (int64, error) {
+	const query = "SELECT COALESCE(MAX(id), 0) FROM report_events;"
+
+	var id int64
+	if err := s.db.GetContext(ctx, &id, query); err != nil {
+		return 0, fmt.Errorf("failed to get latest report event id: %w", err)
+	}
+
+	return id, nil
+}
+
+func (s *ReportsStore) EventsSince(ctx context.Context, afterID int64, limit int) ([]ReportEvent, error) {
+	const query = "SELECT * FROM report_events WHERE id > $1 ORDER BY id LIMIT $2;"
+
+	events := []ReportEvent{}
+	if err := s.db.SelectContext(ctx, &events, query, afterID, limit); err != nil {
+		return nil, fmt.Errorf("failed to list report events after %d: %w", afterID, err)
+	}
+
+	return events, nil
+}
+
+func (s *ReportsStore) UserEventsSince(ctx context.Context, userID uuid.UUID, afterID int64, limit int) ([]ReportEvent, error) {
+	const query = "SELECT * FROM report_events WHERE user_id = $1 AND id > $2 ORDER BY id LIMIT $3;"
+
+	events := []ReportEvent{}
+	if err := s.db.SelectContext(ctx, &events, query, userID, afterID, limit); err != nil {
+		return nil, fmt.Errorf("failed to list report events of user %s after %d: %w", userID, afterID, err)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,57 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+// ReportProgress is how far a running report has got.
+type ReportProgress struct {
+	UserID        uuid.UUID `json:"user_id"`
+	ReportID      uuid.UUID `json:"report_id"`
+	Percent       float64   `json:"percent"`
+	Stage         string    `json:"stage"`
+	RowsProcessed int64     `json:"rows_processed"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// SetProgress saves the progress of a running report owner holds the lease of
+// and notifies listeners about it. Progress of reports that have finished or
+// were handed to another worker in the meantime is ignored.
+func (s *ReportsStore) SetProgress(ctx context.Context, owner string, progress ReportProgress) error {
+	const query = `UPDATE reports SET progress_percent = $4, progress_stage = $5, progress_rows = $6, progress_updated_at = $7
+WHERE user_id = $1 AND id = $2 AND lease_owner = $3 AND started_at IS NOT NULL
+	AND completed_at IS NULL AND failed_at IS NULL AND cancelled_at IS NULL;`
+
+	payload, err := json.Marshal(progress)
+	if err != nil {
+		return fmt.Errorf("failed to encode progress of report %s: %w", progress.ReportID, err)
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, query, progress.UserID, progress.ReportID, owner, progress.Percent, progress.Stage,
+		progress.RowsProcessed, progress.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to set progress of report %s: %w", progress.ReportID, err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+
+	if err := notify(ctx, tx, ChannelReportProgress, string(payload)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit report progress: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+type ReportSharesStore struct {
+	db *sqlx.DB
+}
+
+func NewReportSharesStore(db *sql.DB) *ReportSharesStore {
+	return &ReportSharesStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+// ReportShare gives another user read-only access to a report.
+type ReportShare struct {
+	OwnerID   uuid.UUID `db:"owner_id"`
+	ReportID  uuid.UUID `db:"report_id"`
+	UserID    uuid.UUID `db:"user_id"`
+	Email     string    `db:"email"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// ReportShareLink lets anyone holding its token download a report until it
+// expires, is revoked or has been downloaded MaxDownloads times. Only a hash
+// of the token is stored.
+type ReportShareLink struct {
+	ID           uuid.UUID  `db:"id"`
+	OwnerID      uuid.UUID  `db:"owner_id"`
+	ReportID     uuid.UUID  `db:"report_id"`
+	TokenHash    string     `db:"token_hash"`
+	ExpiresAt    time.Time  `db:"expires_at"`
+	MaxDownloads *int       `db:"max_downloads"`
+	Downloads    int        `db:"downloads"`
+	RevokedAt    *time.Time `db:"revoked_at"`
+	CreatedAt    time.Time  `db:"created_at"`
+}
+
+// Active reports whether the link can still be used at now.
+func (l *ReportShareLink) Active(now time.Time) bool {
+	return l.RevokedAt == nil && now.Before(l.ExpiresAt) && (l.MaxDownloads == nil || l.Downloads < *l.MaxDownloads)
+}
+
+// Share gives userID access to the report of ownerID. Sharing twice with the
+// same user keeps the first share.
+func (s *ReportSharesStore) Share(ctx context.Context, ownerID, reportID, userID uuid.UUID) (*ReportShare, error) {
+	const query = `WITH share AS (
+	INSERT INTO report_shares (owner_id, report_id, user_id) VALUES ($1, $2, $3)
+	ON CONFLICT (report_id, user_id) DO UPDATE SET user_id = EXCLUDED.user_id
+	RETURNING *
+)
+SELECT share.*, users.email FROM share JOIN users ON users.id = share.user_id;`
+
+	var share ReportShare
+	if err := s.db.GetContext(ctx, &share, query, ownerID, reportID, userID); err != nil {
+		return nil, fmt.Errorf("failed to share report %s with user %s: %w", reportID, userID, err)
+	}
+
+	return &share, nil
+}
+
+func (s *ReportSharesStore) ListByReport(ctx context.Context, ownerID, reportID uuid.UUID) ([]ReportShare, error) {
+	const query = `SELECT report_shares.*, users.email FROM report_shares JOIN users ON users.id = report_shares.user_id
+WHERE report_shares.owner_id = $1 AND report_shares.report_id = $2
+ORDER BY report_shares.created_at;`
+
+	shares := []ReportShare{}
+	if err := s.db.SelectContext(ctx, &shares, query, ownerID, reportID); err != nil {
+		return nil, fmt.Errorf("failed to list shares of report %s: %w", reportID, err)
+	}
+
+	return shares, nil
+}
+
+func (s *ReportSharesStore) Unshare(ctx context.Context, ownerID, reportID, userID uuid.UUID) error {
+	const query = "DELETE FROM report_shares WHERE owner_id = $1 AND report_id = $2 AND user_id = $3;"
+
+	res, err := s.db.ExecContext(ctx, query, ownerID, reportID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to unshare report %s with user %s: %w", reportID, userID, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("failed to unshare report %s with user %s: %w", reportID, userID, sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// SharedReport returns a report another user shared with userID.
+func (s *ReportSharesStore) SharedReport(ctx context.Context, userID, reportID uuid.UUID) (*Report, error) {
+	const query = `SELECT reports.* FROM reports
+JOIN report_shares ON report_shares.owner_id = reports.user_id AND report_shares.report_id = reports.id
+WHERE report_shares.user_id = $1 AND report_shares.report_id = $2;`
+
+	var report Report
+	if err := s.db.GetContext(ctx, &report, query, userID, reportID); err != nil {
+		return nil, fmt.Errorf("failed to get report %s shared with user %s: %w", reportID, userID, err)
+	}
+
+	return &report, nil
+}
+
+// ListSharedWith returns the reports other users shared with userID.
+func (s *ReportSharesStore) ListSharedWith(ctx context.Context, userID uuid.UUID) ([]Report, error) {
+	const query = `SELECT reports.* FROM reports
+JOIN report_shares ON report_shares.owner_id = reports.user_id AND report_shares.report_id = reports.id
+WHERE report_shares.user_id = $1
+ORDER BY reports.created_at DESC;`
+
+	reports := []Report{}
+	if err := s.db.SelectContext(ctx, &reports, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to list reports shared with user %s: %w", userID, err)
+	}
+
+	return reports, nil
+}
+
+func (s *ReportSharesStore) CreateLink(ctx context.Context, ownerID, reportID uuid.UUID, tokenHash string, expiresAt time.Time, maxDownloads *int) (*ReportShareLink, error) {
+	const query = `INSERT INTO report_share_links (owner_id, report_id, token_hash, expires_at, max_downloads)
+VALUES ($1, $2, $3, $4, $5) RETURNING *;`
+
+	var link ReportShareLink
+	if err := s.db.GetContext(ctx, &link, query, ownerID, reportID, tokenHash, expiresAt, maxDownloads); err != nil {
+		return nil, fmt.Errorf("failed to create share link for report %s: %w", reportID, err)
+	}
+
+	return &link, nil
+}
+
+func (s *ReportSharesStore) ListLinks(ctx context.Context, ownerID, reportID uuid.UUID) ([]ReportShareLink, error) {
+	const query = "SELECT * FROM report_share_links WHERE owner_id = $1 AND report_id = $2 ORDER BY created_at;"
+
+	links := []ReportShareLink{}
+	if err := s.db.SelectContext(ctx, &links, query, ownerID, reportID); err != nil {
+		return nil, fmt.Errorf("failed to list share links of report %s: %w", reportID, err)
+	}
+
+	return links, nil
+}
+
+// RevokeLink disables a share link for good. sql.ErrNoRows is returned when
+// the link does not exist or has been revoked already.
+func (s *ReportSharesStore) RevokeLink(ctx context.Context, ownerID, reportID, linkID uuid.UUID) (*ReportShareLink, error) {
+	const query = `UPDATE report_share_links SET revoked_at = CURRENT_TIMESTAMP
+WHERE owner_id = $1 AND report_id = $2 AND id = $3 AND revoked_at IS NULL RETURNING *;`
+
+	var link ReportShareLink
+	if err := s.db.GetContext(ctx, &link, query, ownerID, reportID, linkID); err != nil {
+		return nil, fmt.Errorf("failed to revoke share link %s: %w", linkID, err)
+	}
+
+	return &link, nil
+}
+
+func (s *ReportSharesStore) FindLink(ctx context.Context, tokenHash string) (*ReportShareLink, error) {
+	const query = "SELECT * FROM report_share_links WHERE token_hash = $1;"
+
+	var link ReportShareLink
+	if err := s.db.GetContext(ctx, &link, query, tokenHash); err != nil {
+		return nil, fmt.Errorf("failed to get share link: %w", err)
+	}
+
+	return &link, nil
+}
+
+// ConsumeLink counts a download through an active share link before it is
+// served, so concurrent downloads cannot go over the limit. sql.ErrNoRows is
+// returned when the link is unknown, revoked, expired or used up.
+func (s *ReportSharesStore) ConsumeLink(ctx context.Context, tokenHash string) (*ReportShareLink, error) {
+	const query = `UPDATE report_share_links SET downloads = downloads + 1
+WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+	AND (max_downloads IS NULL OR downloads < max_downloads)
+RETURNING *;`
+
+	var link ReportShareLink
+	if err := s.db.GetContext(ctx, &link, query, tokenHash); err != nil {
+		return nil, fmt.Errorf("failed to use share link: %w", err)
+	}
+
+	return &link, nil
+}
+
+// ReleaseLink takes back a download counted by ConsumeLink that was not served
+// after all.
+func (s *ReportSharesStore) ReleaseLink(ctx context.Context, linkID uuid.UUID) error {
+	const query = "UPDATE report_share_links SET downloads = downloads - 1 WHERE id = $1 AND downloads > 0;"
+
+	if _, err := s.db.ExecContext(ctx, query, linkID); err != nil {
+		return fmt.Errorf("failed to release download of share link %s: %w", linkID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,23 @@
+package store_test
+
+import (
+	"github.com/astroniumm/go-asyncapi/store"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestReportShareLinkActive(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	limit := 2
+	revokedAt := now.Add(-time.Minute)
+
+	require.True(t, (&store.ReportShareLink{ExpiresAt: now.Add(time.Hour)}).Active(now))
+	require.True(t, (&store.ReportShareLink{ExpiresAt: now.Add(time.Hour), MaxDownloads: &limit, Downloads: 1}).Active(now))
+
+	// links expire at ExpiresAt
+	require.False(t, (&store.ReportShareLink{ExpiresAt: now}).Active(now))
+	require.False(t, (&store.ReportShareLink{ExpiresAt: now.Add(-time.Second)}).Active(now))
+	require.False(t, (&store.ReportShareLink{ExpiresAt: now.Add(time.Hour), MaxDownloads: &limit, Downloads: 2}).Active(now))
+	require.False(t, (&store.ReportShareLink{ExpiresAt: now.Add(time.Hour), RevokedAt: &revokedAt}).Active(now))
+}
@@ -0,0 +1,628 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"time"
+)
+
+type ReportsStore struct {
+	db *sqlx.DB
+}
+
+func NewReportsStore(db *sql.DB) *ReportsStore {
+	return &ReportsStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+type Report struct {
+	UserID               uuid.UUID       `db:"user_id"`
+	ID                   uuid.UUID       `db:"id"`
+	OutputFilePath       *string         `db:"output_file_path"`
+	DownloadUrl          *string         `db:"download_url"`
+	DownloadUrlExpiresAt *time.Time      `db:"download_url_expires_at"`
+	ErrorMessage         *string         `db:"error_message"`
+	CreatedAt            time.Time       `db:"created_at"`
+	StartedAt            *time.Time      `db:"started_at"`
+	FailedAt             *time.Time      `db:"failed_at"`
+	CompletedAt          *time.Time      `db:"completed_at"`
+	ReportType           string          `db:"report_type"`
+	Params               json.RawMessage `db:"params"`
+	Attempts             int             `db:"attempts"`
+	NextAttemptAt        time.Time       `db:"next_attempt_at"`
+	DeadLetteredAt       *time.Time      `db:"dead_lettered_at"`
+	CancelledAt          *time.Time      `db:"cancelled_at"`
+	ScheduleID           *uuid.UUID      `db:"schedule_id"`
+	OutputContentType    *string         `db:"output_content_type"`
+	OutputFileExtension  *string         `db:"output_file_extension"`
+	ExpiredAt            *time.Time      `db:"expired_at"`
+	OutputSize           *int64          `db:"output_size"`
+	Priority             string          `db:"priority"`
+	ProgressPercent      *float64        `db:"progress_percent"`
+	ProgressStage        *string         `db:"progress_stage"`
+	ProgressRows         *int64          `db:"progress_rows"`
+	ProgressUpdatedAt    *time.Time      `db:"progress_updated_at"`
+	LeaseOwner           *string         `db:"lease_owner"`
+	LeaseExpiresAt       *time.Time      `db:"lease_expires_at"`
+	ScheduledAt          *time.Time      `db:"scheduled_at"`
+	Fingerprint          *string         `db:"fingerprint"`
+	OutputOptions
+	ReportWindow
+}
+
+// ReportWindow is the time range a report covers. Start and End are nil until
+// a Preset has been resolved, see ReportsStore.ResolveWindow.
+type ReportWindow struct {
+	Start    *time.Time `db:"window_start"`
+	End      *time.Time `db:"window_end"`
+	Timezone string     `db:"window_timezone"`
+	Preset   *string    `db:"window_preset"`
+}
+
+// OutputOptions are the output format requested for a report.
+type OutputOptions struct {
+	Format string `db:"output_format"`
+	Gzip   bool   `db:"output_gzip"`
+}
+
+type ReportStatus string
+
+const (
+	ReportStatusPending   ReportStatus = "pending"
+	ReportStatusRunning   ReportStatus = "running"
+	ReportStatusCompleted ReportStatus = "completed"
+	ReportStatusFailed    ReportStatus = "failed"
+	ReportStatusDead      ReportStatus = "dead"
+	ReportStatusCancelled ReportStatus = "cancelled"
+	ReportStatusExpired   ReportStatus = "expired"
+)
+
+var ReportStatuses = []ReportStatus{
+	ReportStatusPending, ReportStatusRunning, ReportStatusCompleted, ReportStatusFailed, ReportStatusDead, ReportStatusCancelled, ReportStatusExpired,
+}
+
+// Priorities of reports in the queue, see worker.FairShare for how they are weighed.
+const (
+	ReportPriorityHigh   = "high"
+	ReportPriorityNormal = "normal"
+	ReportPriorityLow    = "low"
+)
+
+var ReportPriorities = []string{ReportPriorityHigh, ReportPriorityNormal, ReportPriorityLow}
+
+// Status derives the lifecycle state of the report from its timestamps.
+func (r *Report) Status() ReportStatus {
+	switch {
+	case r.CancelledAt != nil:
+		return ReportStatusCancelled
+	case r.DeadLetteredAt != nil:
+		return ReportStatusDead
+	case r.FailedAt != nil:
+		return ReportStatusFailed
+	case r.ExpiredAt != nil:
+		return ReportStatusExpired
+	case r.CompletedAt != nil:
+		return ReportStatusCompleted
+	case r.StartedAt != nil:
+		return ReportStatusRunning
+	default:
+		return ReportStatusPending
+	}
+}
+
+// ReportUsage is what a user currently takes up of the report queue and storage.
+type ReportUsage struct {
+	// ConcurrentReports are the reports that are pending or running.
+	ConcurrentReports int64 `db:"concurrent_reports"`
+	// DailyReports are the reports submitted since the start of the day.
+	DailyReports int64 `db:"daily_reports"`
+	// RetainedBytes is the size of the outputs that have not expired yet.
+	RetainedBytes int64 `db:"retained_bytes"`
+}
+
+const reportUsageQuery = `SELECT
+	COUNT(*) FILTER (WHERE completed_at IS NULL AND failed_at IS NULL AND cancelled_at IS NULL) AS concurrent_reports,
+	COUNT(*) FILTER (WHERE created_at >= $2) AS daily_reports,
+	COALESCE(SUM(output_size) FILTER (WHERE output_file_path IS NOT NULL AND expired_at IS NULL), 0) AS retained_bytes
+FROM reports WHERE user_id = $1;`
+
+// Usage counts the reports of a user, with daily reports counted from dayStart.
+func (s *ReportsStore) Usage(ctx context.Context, userID uuid.UUID, dayStart time.Time) (*ReportUsage, error) {
+	var usage ReportUsage
+	if err := s.db.GetContext(ctx, &usage, reportUsageQuery, userID, dayStart); err != nil {
+		return nil, fmt.Errorf("failed to get report usage of user %s: %w", userID, err)
+	}
+
+	return &usage, nil
+}
+
+// ReportDedup decides whether CreateReport returns an existing report with the
+// same fingerprint instead of creating another one.
+type ReportDedup struct {
+	Fingerprint string
+	// InFlight attaches to an identical report that is pending or running.
+	InFlight bool
+	// CompletedSince reuses an identical report completed after it whose output
+	// has not expired, nil disables reuse.
+	CompletedSince *time.Time
+}
+
+func (d ReportDedup) enabled() bool {
+	return d.Fingerprint != "" && (d.InFlight || d.CompletedSince != nil)
+}
+
+// CreateReport enqueues a report, unless dedup finds an identical one to return
+// instead; created tells the two apart. When admit is set it is given the usage
+// of the user, with daily reports counted from dayStart, and the report is only
+// created if it returns no error. Submissions of the same user are serialized
+// while dedup and admit decide, so concurrent requests cannot slip past a limit
+// or create the same report twice.
+func (s *ReportsStore) CreateReport(ctx context.Context, userID uuid.UUID, window ReportWindow, reportType string, params json.RawMessage, priority string,
+	output OutputOptions, dedup ReportDedup, dayStart time.Time, admit func(*ReportUsage) error) (report *Report, created bool, err error) {
+	const (
+		lockQuery  = "SELECT id FROM users WHERE id = $1 FOR NO KEY UPDATE;"
+		dedupQuery = `SELECT * FROM reports WHERE user_id = $1 AND fingerprint = $2 AND failed_at IS NULL AND cancelled_at IS NULL AND (
+	($3 AND completed_at IS NULL) OR
+	(completed_at >= $4 AND expired_at IS NULL AND output_file_path IS NOT NULL)
+)
+ORDER BY completed_at IS NULL DESC, created_at DESC LIMIT 1;`
+		insertQuery = `INSERT INTO reports (user_id, window_start, window_end, window_timezone, window_preset,
+	report_type, params, priority, output_format, output_gzip, fingerprint)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING *;`
+	)
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if admit != nil || dedup.enabled() {
+		var lockedID uuid.UUID
+		if err := tx.GetContext(ctx, &lockedID, lockQuery, userID); err != nil {
+			return nil, false, fmt.Errorf("failed to lock user %s: %w", userID, err)
+		}
+	}
+
+	if dedup.enabled() {
+		var existing Report
+		err := tx.GetContext(ctx, &existing, dedupQuery, userID, dedup.Fingerprint, dedup.InFlight, dedup.CompletedSince)
+		if err == nil {
+			return &existing, false, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, false, fmt.Errorf("failed to look up identical reports of user %s: %w", userID, err)
+		}
+	}
+
+	if admit != nil {
+		var usage ReportUsage
+		if err := tx.GetContext(ctx, &usage, reportUsageQuery, userID, dayStart); err != nil {
+			return nil, false, fmt.Errorf("failed to get report usage of user %s: %w", userID, err)
+		}
+		if err := admit(&usage); err != nil {
+			return nil, false, err
+		}
+	}
+
+	var fingerprint *string
+	if dedup.Fingerprint != "" {
+		fingerprint = &dedup.Fingerprint
+	}
+
+	report = &Report{}
+	if err := transitionTx(ctx, tx, report, insertQuery, userID, window.Start, window.End, window.Timezone, window.Preset,
+		reportType, string(params), priority, output.Format, output.Gzip, fingerprint); err != nil {
+		return nil, false, fmt.Errorf("failed to create report: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("failed to commit report creation: %w", err)
+	}
+
+	return report, true, nil
+}
+
+func (s *ReportsStore) ByPrimaryKey(ctx context.Context, userID, reportID uuid.UUID) (*Report, error) {
+	const query = "SELECT * FROM reports WHERE user_id = $1 AND id = $2;"
+
+	var report Report
+	if err := s.db.GetContext(ctx, &report, query, userID, reportID); err != nil {
+		return nil, fmt.Errorf("failed to get report %s for user %s: %w", reportID, userID, err)
+	}
+
+	return &report, nil
+}
+
+// FindByID looks a report up without scoping it to a user, e.g. for signed download links.
+func (s *ReportsStore) FindByID(ctx context.Context, reportID uuid.UUID) (*Report, error) {
+	const query = "SELECT * FROM reports WHERE id = $1;"
+
+	var report Report
+	if err := s.db.GetContext(ctx, &report, query, reportID); err != nil {
+		return nil, fmt.Errorf("failed to get report by ID(%s): %w", reportID, err)
+	}
+
+	return &report, nil
+}
+
+func (s *ReportsStore) ListByUser(ctx context.Context, userID uuid.UUID) ([]Report, error) {
+	const query = "SELECT * FROM reports WHERE user_id = $1 ORDER BY created_at DESC;"
+
+	reports := []Report{}
+	if err := s.db.SelectContext(ctx, &reports, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to list reports for user %s: %w", userID, err)
+	}
+
+	return reports, nil
+}
+
+// QueueCandidate is the next due report of a user at one priority, with how many
+// reports of the user and of the whole priority were claimed recently.
+type QueueCandidate struct {
+	UserID         uuid.UUID `db:"user_id"`
+	ID             uuid.UUID `db:"id"`
+	Priority       string    `db:"priority"`
+	NextAttemptAt  time.Time `db:"next_attempt_at"`
+	CreatedAt      time.Time `db:"created_at"`
+	UserClaims     int64     `db:"user_claims"`
+	PriorityClaims int64     `db:"priority_claims"`
+}
+
+// QueueCandidates returns the oldest due report of every user at every priority.
+// Claims are counted from claimedSince.
+func (s *ReportsStore) QueueCandidates(ctx context.Context, claimedSince time.Time) ([]QueueCandidate, error) {
+	const query = `WITH heads AS (
+	SELECT DISTINCT ON (priority, user_id) user_id, id, priority, next_attempt_at, created_at FROM reports
+	WHERE started_at IS NULL AND failed_at IS NULL AND completed_at IS NULL AND cancelled_at IS NULL
+		AND next_attempt_at <= CURRENT_TIMESTAMP
+	ORDER BY priority, user_id, next_attempt_at, created_at
+), claims AS (
+	SELECT priority, user_id, COUNT(*) AS claims FROM reports WHERE started_at >= $1 GROUP BY priority, user_id
+)
+SELECT heads.*, COALESCE(user_claims.claims, 0) AS user_claims,
+	COALESCE((SELECT SUM(claims) FROM claims WHERE claims.priority = heads.priority), 0)::bigint AS priority_claims
+FROM heads
+LEFT JOIN claims AS user_claims ON user_claims.priority = heads.priority AND user_claims.user_id = heads.user_id;`
+
+	candidates := []QueueCandidate{}
+	if err := s.db.SelectContext(ctx, &candidates, query, claimedSince); err != nil {
+		return nil, fmt.Errorf("failed to list queue candidates: %w", err)
+	}
+
+	return candidates, nil
+}
+
+// ClaimNext marks the first of the queue candidates, in the order given by order,
+// that is still due as started, counts the attempt and returns it. The report is
+// leased to owner for lease, the lease has to be renewed until the report
+// finishes or it is handed to another worker. Rows locked by other workers are
+// skipped, so several processes can share the queue. sql.ErrNoRows is returned
+// when nothing is due.
+func (s *ReportsStore) ClaimNext(ctx context.Context, owner string, lease time.Duration, claimedSince time.Time,
+	order func([]QueueCandidate) []QueueCandidate) (*Report, error) {
+	const query = `UPDATE reports SET started_at = CURRENT_TIMESTAMP, attempts = attempts + 1,
+	lease_owner = $3, lease_expires_at = CURRENT_TIMESTAMP + $4 * INTERVAL '1 millisecond',
+	progress_percent = NULL, progress_stage = NULL, progress_rows = NULL, progress_updated_at = NULL
+WHERE (user_id, id) = (
+	SELECT user_id, id FROM reports
+	WHERE user_id = $1 AND id = $2
+		AND started_at IS NULL AND failed_at IS NULL AND completed_at IS NULL AND cancelled_at IS NULL
+		AND next_attempt_at <= CURRENT_TIMESTAMP
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING *;`
+
+	candidates, err := s.QueueCandidates(ctx, claimedSince)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim next report: %w", err)
+	}
+
+	// candidates taken by other workers in the meantime are skipped
+	for _, candidate := range order(candidates) {
+		var report Report
+		err := s.transition(ctx, &report, query, candidate.UserID, candidate.ID, owner, lease.Milliseconds())
+		if err == nil {
+			return &report, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("failed to claim report %s: %w", candidate.ID, err)
+		}
+	}
+
+	return nil, fmt.Errorf("failed to claim next report: %w", sql.ErrNoRows)
+}
+
+// CompleteReport marks a report owner holds the lease of as completed. The
+// outcomes recorded by CompleteReport, FailReport, RetryReport and
+// DeadLetterReport return sql.ErrNoRows when the report was cancelled, has
+// finished already or is no longer leased to owner, e.g. because the reaper
+// returned it to the queue after its lease expired.
+func (s *ReportsStore) CompleteReport(ctx context.Context, userID, reportID uuid.UUID, owner string) (*Report, error) {
+	const query = `UPDATE reports SET completed_at = CURRENT_TIMESTAMP, error_message = NULL
+WHERE user_id = $1 AND id = $2 AND lease_owner = $3
+	AND completed_at IS NULL AND failed_at IS NULL AND cancelled_at IS NULL
+RETURNING *;`
+
+	var report Report
+	if err := s.transition(ctx, &report, query, userID, reportID, owner); err != nil {
+		return nil, fmt.Errorf("failed to complete report %s: %w", reportID, err)
+	}
+
+	return &report, nil
+}
+
+func (s *ReportsStore) FailReport(ctx context.Context, userID, reportID uuid.UUID, owner, errorMessage string) (*Report, error) {
+	const query = `UPDATE reports SET failed_at = CURRENT_TIMESTAMP, error_message = $4
+WHERE user_id = $1 AND id = $2 AND lease_owner = $3
+	AND completed_at IS NULL AND failed_at IS NULL AND cancelled_at IS NULL
+RETURNING *;`
+
+	var report Report
+	if err := s.transition(ctx, &report, query, userID, reportID, owner, errorMessage); err != nil {
+		return nil, fmt.Errorf("failed to mark report %s as failed: %w", reportID, err)
+	}
+
+	return &report, nil
+}
+
+// RetryReport records a failed attempt and puts the report back into the queue
+// once nextAttemptAt has passed.
+func (s *ReportsStore) RetryReport(ctx context.Context, userID, reportID uuid.UUID, owner, errorMessage string, nextAttemptAt time.Time) (*Report, error) {
+	const query = `UPDATE reports SET started_at = NULL, lease_owner = NULL, lease_expires_at = NULL,
+	error_message = $4, next_attempt_at = $5
+WHERE user_id = $1 AND id = $2 AND lease_owner = $3
+	AND completed_at IS NULL AND failed_at IS NULL AND cancelled_at IS NULL
+RETURNING *;`
+
+	var report Report
+	if err := s.transition(ctx, &report, query, userID, reportID, owner, errorMessage, nextAttemptAt); err != nil {
+		return nil, fmt.Errorf("failed to schedule retry of report %s: %w", reportID, err)
+	}
+
+	return &report, nil
+}
+
+// DeadLetterReport moves a report that ran out of attempts into the terminal dead-letter state.
+func (s *ReportsStore) DeadLetterReport(ctx context.Context, userID, reportID uuid.UUID, owner, errorMessage string) (*Report, error) {
+	const query = `UPDATE reports SET failed_at = CURRENT_TIMESTAMP, dead_lettered_at = CURRENT_TIMESTAMP, error_message = $4
+WHERE user_id = $1 AND id = $2 AND lease_owner = $3
+	AND completed_at IS NULL AND failed_at IS NULL AND cancelled_at IS NULL
+RETURNING *;`
+
+	var report Report
+	if err := s.transition(ctx, &report, query, userID, reportID, owner, errorMessage); err != nil {
+		return nil, fmt.Errorf("failed to dead-letter report %s: %w", reportID, err)
+	}
+
+	return &report, nil
+}
+
+// RequeueReport gives a dead-lettered report a fresh set of attempts.
+// sql.ErrNoRows is returned when the report is not dead-lettered.
+func (s *ReportsStore) RequeueReport(ctx context.Context, userID, reportID uuid.UUID) (*Report, error) {
+	const query = `UPDATE reports SET attempts = 0, next_attempt_at = CURRENT_TIMESTAMP,
+	started_at = NULL, failed_at = NULL, dead_lettered_at = NULL, lease_owner = NULL, lease_expires_at = NULL
+WHERE user_id = $1 AND id = $2 AND dead_lettered_at IS NOT NULL RETURNING *;`
+
+	var report Report
+	if err := s.transition(ctx, &report, query, userID, reportID); err != nil {
+		return nil, fmt.Errorf("failed to requeue report %s: %w", reportID, err)
+	}
+
+	return &report, nil
+}
+
+// ReleaseReport puts a started report owner holds the lease of back into the
+// queue without counting the attempt, e.g. when its worker shuts down mid-run.
+func (s *ReportsStore) ReleaseReport(ctx context.Context, userID, reportID uuid.UUID, owner string) error {
+	const query = `UPDATE reports SET started_at = NULL, attempts = GREATEST(attempts - 1, 0),
+	lease_owner = NULL, lease_expires_at = NULL
+WHERE user_id = $1 AND id = $2 AND lease_owner = $3
+	AND completed_at IS NULL AND failed_at IS NULL AND cancelled_at IS NULL
+RETURNING *;`
+
+	var report Report
+	if err := s.transition(ctx, &report, query, userID, reportID, owner); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to release report %s: %w", reportID, err)
+	}
+
+	return nil
+}
+
+// CancelReport marks a pending or running report as cancelled.
+// sql.ErrNoRows is returned when the report has already finished.
+func (s *ReportsStore) CancelReport(ctx context.Context, userID, reportID uuid.UUID) (*Report, error) {
+	const query = `UPDATE reports SET cancelled_at = CURRENT_TIMESTAMP
+WHERE user_id = $1 AND id = $2 AND cancelled_at IS NULL AND completed_at IS NULL AND failed_at IS NULL
+RETURNING *;`
+
+	var report Report
+	if err := s.transition(ctx, &report, query, userID, reportID); err != nil {
+		return nil, fmt.Errorf("failed to cancel report %s: %w", reportID, err)
+	}
+
+	return &report, nil
+}
+
+// RenewLeases extends the leases owner holds on the given reports and returns
+// the reports whose lease it still holds.
+func (s *ReportsStore) RenewLeases(ctx context.Context, owner string, reportIDs []uuid.UUID, lease time.Duration) ([]uuid.UUID, error) {
+	const query = `UPDATE reports SET lease_expires_at = CURRENT_TIMESTAMP + $3 * INTERVAL '1 millisecond'
+WHERE id = ANY($2::uuid[]) AND lease_owner = $1
+	AND started_at IS NOT NULL AND completed_at IS NULL AND failed_at IS NULL AND cancelled_at IS NULL
+RETURNING id;`
+
+	ids := make([]string, 0, len(reportIDs))
+	for _, id := range reportIDs {
+		ids = append(ids, id.String())
+	}
+
+	renewed := []uuid.UUID{}
+	if err := s.db.SelectContext(ctx, &renewed, query, owner, pq.Array(ids), lease.Milliseconds()); err != nil {
+		return nil, fmt.Errorf("failed to renew report leases of %s: %w", owner, err)
+	}
+
+	return renewed, nil
+}
+
+// ExpiredLeases returns running reports whose lease has not been renewed in
+// time, most likely because their worker died.
+func (s *ReportsStore) ExpiredLeases(ctx context.Context, limit int) ([]Report, error) {
+	const query = `SELECT * FROM reports
+WHERE started_at IS NOT NULL AND completed_at IS NULL AND failed_at IS NULL AND cancelled_at IS NULL
+	AND lease_expires_at < CURRENT_TIMESTAMP
+ORDER BY lease_expires_at
+LIMIT $1;`
+
+	reports := []Report{}
+	if err := s.db.SelectContext(ctx, &reports, query, limit); err != nil {
+		return nil, fmt.Errorf("failed to list reports with expired leases: %w", err)
+	}
+
+	return reports, nil
+}
+
+// RecoverExpiredLease returns a report whose lease expired to the queue once
+// nextAttemptAt has passed, keeping the attempt it was claimed with. When
+// nextAttemptAt is nil the report ran out of attempts and is dead-lettered.
+// sql.ErrNoRows is returned when the lease was renewed or the report finished
+// in the meantime.
+func (s *ReportsStore) RecoverExpiredLease(ctx context.Context, userID, reportID uuid.UUID, errorMessage string, nextAttemptAt *time.Time) (*Report, error) {
+	const (
+		retryQuery = `UPDATE reports SET started_at = NULL, lease_owner = NULL, lease_expires_at = NULL,
+	error_message = $3, next_attempt_at = $4
+WHERE user_id = $1 AND id = $2 AND lease_expires_at < CURRENT_TIMESTAMP
+	AND started_at IS NOT NULL AND completed_at IS NULL AND failed_at IS NULL AND cancelled_at IS NULL
+RETURNING *;`
+		deadLetterQuery = `UPDATE reports SET failed_at = CURRENT_TIMESTAMP, dead_lettered_at = CURRENT_TIMESTAMP,
+	lease_owner = NULL, lease_expires_at = NULL, error_message = $3
+WHERE user_id = $1 AND id = $2 AND lease_expires_at < CURRENT_TIMESTAMP
+	AND started_at IS NOT NULL AND completed_at IS NULL AND failed_at IS NULL AND cancelled_at IS NULL
+RETURNING *;`
+	)
+
+	var report Report
+	var err error
+	if nextAttemptAt != nil {
+		err = s.transition(ctx, &report, retryQuery, userID, reportID, errorMessage, *nextAttemptAt)
+	} else {
+		err = s.transition(ctx, &report, deadLetterQuery, userID, reportID, errorMessage)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover report %s with expired lease: %w", reportID, err)
+	}
+
+	return &report, nil
+}
+
+// CancelledAmong returns which of the given reports have been cancelled.
+func (s *ReportsStore) CancelledAmong(ctx context.Context, reportIDs []uuid.UUID) ([]uuid.UUID, error) {
+	const query = "SELECT id FROM reports WHERE id = ANY($1::uuid[]) AND cancelled_at IS NOT NULL;"
+
+	ids := make([]string, 0, len(reportIDs))
+	for _, id := range reportIDs {
+		ids = append(ids, id.String())
+	}
+
+	cancelled := []uuid.UUID{}
+	if err := s.db.SelectContext(ctx, &cancelled, query, pq.Array(ids)); err != nil {
+		return nil, fmt.Errorf("failed to check reports for cancellation: %w", err)
+	}
+
+	return cancelled, nil
+}
+
+// ExpiredOutputs returns reports whose output is older than the retention of
+// their type, oldest first. retentionByType overrides defaultRetention, a
+// retention of zero keeps outputs forever.
+func (s *ReportsStore) ExpiredOutputs(ctx context.Context, defaultRetention time.Duration, retentionByType map[string]time.Duration, limit int) ([]Report, error) {
+	const query = `SELECT reports.* FROM reports
+LEFT JOIN unnest($1::varchar[], $2::bigint[]) AS retention (report_type, seconds) ON retention.report_type = reports.report_type
+WHERE reports.output_file_path IS NOT NULL AND reports.expired_at IS NULL
+	AND COALESCE(retention.seconds, $3) > 0
+	AND COALESCE(reports.completed_at, reports.created_at) < CURRENT_TIMESTAMP - COALESCE(retention.seconds, $3) * INTERVAL '1 second'
+ORDER BY COALESCE(reports.completed_at, reports.created_at)
+LIMIT $4;`
+
+	types := make([]string, 0, len(retentionByType))
+	seconds := make([]int64, 0, len(retentionByType))
+	for reportType, retention := range retentionByType {
+		types = append(types, reportType)
+		seconds = append(seconds, int64(retention.Seconds()))
+	}
+
+	reports := []Report{}
+	if err := s.db.SelectContext(ctx, &reports, query, pq.Array(types), pq.Array(seconds), int64(defaultRetention.Seconds()), limit); err != nil {
+		return nil, fmt.Errorf("failed to list expired report outputs: %w", err)
+	}
+
+	return reports, nil
+}
+
+// ExpireReport forgets the output of a report once it has been deleted from storage.
+func (s *ReportsStore) ExpireReport(ctx context.Context, userID, reportID uuid.UUID) (*Report, error) {
+	const query = `UPDATE reports SET expired_at = CURRENT_TIMESTAMP, output_file_path = NULL,
+	download_url = NULL, download_url_expires_at = NULL
+WHERE user_id = $1 AND id = $2 AND expired_at IS NULL RETURNING *;`
+
+	var report Report
+	if err := s.transition(ctx, &report, query, userID, reportID); err != nil {
+		return nil, fmt.Errorf("failed to expire report %s: %w", reportID, err)
+	}
+
+	return &report, nil
+}
+
+// SetOutput records where the output of a running report owner holds the lease
+// of is stored and its size in bytes, with the content type and file extension
+// it is served with. sql.ErrNoRows is returned when owner lost the lease.
+func (s *ReportsStore) SetOutput(ctx context.Context, userID, reportID uuid.UUID, owner, outputFilePath string, size int64, contentType, fileExtension string) error {
+	const query = `UPDATE reports SET output_file_path = $4, output_size = $5, output_content_type = $6, output_file_extension = $7
+WHERE user_id = $1 AND id = $2 AND lease_owner = $3
+	AND completed_at IS NULL AND failed_at IS NULL AND cancelled_at IS NULL;`
+
+	res, err := s.db.ExecContext(ctx, query, userID, reportID, owner, outputFilePath, size, contentType, fileExtension)
+	if err != nil {
+		return fmt.Errorf("failed to set output file path of report %s: %w", reportID, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to set output file path of report %s: %w", reportID, err)
+	} else if n == 0 {
+		return fmt.Errorf("failed to set output file path of report %s: %w", reportID, sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// ResolveWindow records the instants a window preset resolved to when the report
+// first ran, so retries cover the same range. The window resolved first wins.
+func (s *ReportsStore) ResolveWindow(ctx context.Context, userID, reportID uuid.UUID, start, end time.Time) (*ReportWindow, error) {
+	const query = `UPDATE reports SET window_start = COALESCE(window_start, $3), window_end = COALESCE(window_end, $4)
+WHERE user_id = $1 AND id = $2
+RETURNING window_start, window_end, window_timezone, window_preset;`
+
+	var window ReportWindow
+	if err := s.db.GetContext(ctx, &window, query, userID, reportID, start, end); err != nil {
+		return nil, fmt.Errorf("failed to resolve window of report %s: %w", reportID, err)
+	}
+
+	return &window, nil
+}
+
+func (s *ReportsStore) SetDownloadUrl(ctx context.Context, userID, reportID uuid.UUID, downloadUrl string, expiresAt time.Time) error {
+	const query = "UPDATE reports SET download_url = $3, download_url_expires_at = $4 WHERE user_id = $1 AND id = $2;"
+
+	if _, err := s.db.ExecContext(ctx, query, userID, reportID, downloadUrl, expiresAt); err != nil {
+		return fmt.Errorf("failed to set download url of report %s: %w", reportID, err)
+	}
+
+	return nil
+}
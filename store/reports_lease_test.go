@@ -0,0 +1,91 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/astroniumm/go-asyncapi/store"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+	"time"
+)
+
+// leaseTestStore uses the database in TEST_DB_URL, which has to be migrated,
+// e.g. with make db_migrate.
+func leaseTestStore(t *testing.T) *store.Store {
+	dsn := os.Getenv("TEST_DB_URL")
+	if dsn == "" {
+		t.Skip("TEST_DB_URL is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return store.New(db)
+}
+
+// only orders the queue so that just the given report is claimed.
+func only(reportID uuid.UUID) func([]store.QueueCandidate) []store.QueueCandidate {
+	return func(candidates []store.QueueCandidate) []store.QueueCandidate {
+		for _, candidate := range candidates {
+			if candidate.ID == reportID {
+				return []store.QueueCandidate{candidate}
+			}
+		}
+		return nil
+	}
+}
+
+func TestStaleWorkerCannotRecordOutcomes(t *testing.T) {
+	s := leaseTestStore(t)
+	ctx := context.Background()
+
+	user, err := s.Users.CreateUser(ctx, uuid.NewString()+"@example.com", "password")
+	require.NoError(t, err)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+	created, _, err := s.Reports.CreateReport(ctx, user.ID, store.ReportWindow{Start: &start, End: &end, Timezone: "UTC"},
+		"signups", json.RawMessage("{}"), store.ReportPriorityNormal, store.OutputOptions{Format: "csv"},
+		store.ReportDedup{}, time.Now(), nil)
+	require.NoError(t, err)
+
+	// the stale worker stalls past its lease, the reaper returns the report to
+	// the queue and another worker claims it
+	_, err = s.Reports.ClaimNext(ctx, "stale", time.Millisecond, time.Now(), only(created.ID))
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	now := time.Now()
+	_, err = s.Reports.RecoverExpiredLease(ctx, user.ID, created.ID, "lease expired", &now)
+	require.NoError(t, err)
+	_, err = s.Reports.ClaimNext(ctx, "current", time.Minute, time.Now(), only(created.ID))
+	require.NoError(t, err)
+
+	_, err = s.Reports.CompleteReport(ctx, user.ID, created.ID, "stale")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = s.Reports.FailReport(ctx, user.ID, created.ID, "stale", "boom")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = s.Reports.RetryReport(ctx, user.ID, created.ID, "stale", "boom", time.Now())
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = s.Reports.DeadLetterReport(ctx, user.ID, created.ID, "stale", "boom")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	err = s.Reports.SetOutput(ctx, user.ID, created.ID, "stale", "stale-output", 1, "text/csv", ".csv")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.NoError(t, s.Reports.SetProgress(ctx, "stale", store.ReportProgress{UserID: user.ID, ReportID: created.ID, Percent: 50, UpdatedAt: time.Now()}))
+	require.NoError(t, s.Reports.ReleaseReport(ctx, user.ID, created.ID, "stale"))
+
+	running, err := s.Reports.ByPrimaryKey(ctx, user.ID, created.ID)
+	require.NoError(t, err)
+	require.NotNil(t, running.StartedAt)
+	require.Equal(t, "current", *running.LeaseOwner)
+	require.Nil(t, running.OutputFilePath)
+	require.Nil(t, running.ProgressPercent)
+
+	// the current worker records its outcome once
+	require.NoError(t, s.Reports.SetOutput(ctx, user.ID, created.ID, "current", "output", 1, "text/csv", ".csv"))
+	completed, err := s.Reports.CompleteReport(ctx, user.ID, created.ID, "current")
+	require.NoError(t, err)
+	require.NotNil(t, completed.CompletedAt)
+	_, err = s.Reports.CompleteReport(ctx, user.ID, created.ID, "current")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
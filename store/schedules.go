@@ -0,0 +1,272 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+type SchedulesStore struct {
+	db *sqlx.DB
+}
+
+func NewSchedulesStore(db *sql.DB) *SchedulesStore {
+	return &SchedulesStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+// ReportSchedule enqueues a report of its type and params every time its cron
+// expression fires in its timezone.
+type ReportSchedule struct {
+	ID            uuid.UUID       `db:"id"`
+	UserID        uuid.UUID       `db:"user_id"`
+	CronExpr      string          `db:"cron_expr"`
+	Timezone      string          `db:"timezone"`
+	ReportType    string          `db:"report_type"`
+	Params        json.RawMessage `db:"params"`
+	MisfirePolicy string          `db:"misfire_policy"`
+	NextRunAt     time.Time       `db:"next_run_at"`
+	LastRunAt     *time.Time      `db:"last_run_at"`
+	CreatedAt     time.Time       `db:"created_at"`
+	WindowPreset  string          `db:"window_preset"`
+	// DisabledAt is set when the schedule cannot run anymore, e.g. because its
+	// cron expression has no further runs. Disabled schedules never fire.
+	DisabledAt     *time.Time `db:"disabled_at"`
+	DisabledReason *string    `db:"disabled_reason"`
+	OutputOptions
+}
+
+// SchedulePlan lists the runs to enqueue for a due schedule and when it is due next.
+type SchedulePlan struct {
+	RunTimes  []time.Time
+	NextRunAt time.Time
+}
+
+type ScheduleParams struct {
+	CronExpr      string
+	Timezone      string
+	ReportType    string
+	Params        json.RawMessage
+	MisfirePolicy string
+	NextRunAt     time.Time
+	WindowPreset  string
+	Output        OutputOptions
+}
+
+const scheduleCountQuery = "SELECT COUNT(*) FROM report_schedules WHERE user_id = $1;"
+
+// Create adds a report schedule. When admit is set it is given the number of
+// schedules the user already has and the schedule is only created if it returns
+// no error. Creations of the same user are serialized while admit decides.
+func (s *SchedulesStore) Create(ctx context.Context, userID uuid.UUID, params ScheduleParams, admit func(schedules int64) error) (*ReportSchedule, error) {
+	const (
+		lockQuery   = "SELECT id FROM users WHERE id = $1 FOR NO KEY UPDATE;"
+		insertQuery = `INSERT INTO report_schedules (user_id, cron_expr, timezone, report_type, params, misfire_policy, next_run_at,
+	window_preset, output_format, output_gzip)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING *;`
+	)
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if admit != nil {
+		var lockedID uuid.UUID
+		if err := tx.GetContext(ctx, &lockedID, lockQuery, userID); err != nil {
+			return nil, fmt.Errorf("failed to lock user %s: %w", userID, err)
+		}
+		var count int64
+		if err := tx.GetContext(ctx, &count, scheduleCountQuery, userID); err != nil {
+			return nil, fmt.Errorf("failed to count report schedules of user %s: %w", userID, err)
+		}
+		if err := admit(count); err != nil {
+			return nil, err
+		}
+	}
+
+	var schedule ReportSchedule
+	if err := tx.GetContext(ctx, &schedule, insertQuery, userID, params.CronExpr, params.Timezone, params.ReportType,
+		string(params.Params), params.MisfirePolicy, params.NextRunAt, params.WindowPreset,
+		params.Output.Format, params.Output.Gzip); err != nil {
+		return nil, fmt.Errorf("failed to create report schedule: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit report schedule creation: %w", err)
+	}
+
+	return &schedule, nil
+}
+
+// Count returns the number of report schedules of a user.
+func (s *SchedulesStore) Count(ctx context.Context, userID uuid.UUID) (int64, error) {
+	var count int64
+	if err := s.db.GetContext(ctx, &count, scheduleCountQuery, userID); err != nil {
+		return 0, fmt.Errorf("failed to count report schedules of user %s: %w", userID, err)
+	}
+
+	return count, nil
+}
+
+func (s *SchedulesStore) ByPrimaryKey(ctx context.Context, userID, scheduleID uuid.UUID) (*ReportSchedule, error) {
+	const query = "SELECT * FROM report_schedules WHERE user_id = $1 AND id = $2;"
+
+	var schedule ReportSchedule
+	if err := s.db.GetContext(ctx, &schedule, query, userID, scheduleID); err != nil {
+		return nil, fmt.Errorf("failed to get report schedule %s for user %s: %w", scheduleID, userID, err)
+	}
+
+	return &schedule, nil
+}
+
+func (s *SchedulesStore) ListByUser(ctx context.Context, userID uuid.UUID) ([]ReportSchedule, error) {
+	const query = "SELECT * FROM report_schedules WHERE user_id = $1 ORDER BY created_at DESC;"
+
+	schedules := []ReportSchedule{}
+	if err := s.db.SelectContext(ctx, &schedules, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to list report schedules for user %s: %w", userID, err)
+	}
+
+	return schedules, nil
+}
+
+// Delete removes a schedule. Reports it already enqueued are kept. sql.ErrNoRows
+// is returned when the user has no such schedule.
+func (s *SchedulesStore) Delete(ctx context.Context, userID, scheduleID uuid.UUID) error {
+	const query = "DELETE FROM report_schedules WHERE user_id = $1 AND id = $2;"
+
+	res, err := s.db.ExecContext(ctx, query, userID, scheduleID)
+	if err != nil {
+		return fmt.Errorf("failed to delete report schedule %s: %w", scheduleID, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("failed to delete report schedule %s: %w", scheduleID, sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// failedRunRetryDelay is how long a schedule whose runs could not be enqueued
+// waits before it is fired again, so it does not hold up the other schedules.
+const failedRunRetryDelay = 5 * time.Minute
+
+// FireDue locks the schedule that has been due the longest, enqueues the reports
+// planned for it and moves it to its next run, all in one transaction. Schedules
+// locked by other replicas are skipped, so every run is enqueued once.
+// sql.ErrNoRows is returned when no schedule is due.
+//
+// A schedule that cannot be planned, or has no further runs, is disabled. One
+// whose runs cannot be enqueued is retried after failedRunRetryDelay. Either
+// way the schedule is returned along with the error, and other schedules can
+// fire in the meantime.
+//
+// Runs are subject to the same quota as submitted reports: when admit is set it
+// is given the usage of the owner, with daily reports counted from dayStart,
+// before each run. Runs it rejects are skipped, the schedule still moves on and
+// the last rejection is returned along with the schedule.
+func (s *SchedulesStore) FireDue(ctx context.Context, plan func(*ReportSchedule) (*SchedulePlan, error),
+	dayStart time.Time, admit func(*ReportUsage) error) (*ReportSchedule, []Report, error) {
+	const (
+		lockQuery   = "SELECT id FROM users WHERE id = $1 FOR NO KEY UPDATE;"
+		selectQuery = `SELECT * FROM report_schedules WHERE next_run_at <= CURRENT_TIMESTAMP AND disabled_at IS NULL
+ORDER BY next_run_at LIMIT 1 FOR UPDATE SKIP LOCKED;`
+		// runs enqueued before are skipped, e.g. when a schedule was retried
+		insertQuery = `INSERT INTO reports (user_id, scheduled_at, window_timezone, window_preset, report_type, params, schedule_id,
+	output_format, output_gzip)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+ON CONFLICT (schedule_id, scheduled_at) WHERE schedule_id IS NOT NULL DO NOTHING
+RETURNING *;`
+		updateQuery = `UPDATE report_schedules SET next_run_at = $2, last_run_at = COALESCE($3, last_run_at)
+WHERE id = $1 RETURNING *;`
+		disableQuery = `UPDATE report_schedules SET disabled_at = CURRENT_TIMESTAMP, disabled_reason = $2
+WHERE id = $1 RETURNING *;`
+		deferQuery = "UPDATE report_schedules SET next_run_at = $2 WHERE id = $1 AND disabled_at IS NULL RETURNING *;"
+	)
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var schedule ReportSchedule
+	if err := tx.GetContext(ctx, &schedule, selectQuery); err != nil {
+		return nil, nil, fmt.Errorf("failed to get due report schedule: %w", err)
+	}
+
+	p, err := plan(&schedule)
+	if err == nil && p.NextRunAt.IsZero() {
+		err = errors.New("the cron expression has no further runs")
+	}
+	if err != nil {
+		planErr := fmt.Errorf("failed to plan runs of report schedule %s: %w", schedule.ID, err)
+		if err := tx.GetContext(ctx, &schedule, disableQuery, schedule.ID, err.Error()); err != nil {
+			return nil, nil, fmt.Errorf("failed to disable report schedule %s: %w", schedule.ID, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, nil, fmt.Errorf("failed to commit disabling of report schedule %s: %w", schedule.ID, err)
+		}
+		return &schedule, nil, planErr
+	}
+
+	if admit != nil && len(p.RunTimes) > 0 {
+		// serializes with reports submitted by the owner, see ReportsStore.CreateReport
+		var lockedID uuid.UUID
+		if err := tx.GetContext(ctx, &lockedID, lockQuery, schedule.UserID); err != nil {
+			return nil, nil, fmt.Errorf("failed to lock user %s: %w", schedule.UserID, err)
+		}
+	}
+
+	reports := make([]Report, 0, len(p.RunTimes))
+	var lastRunAt *time.Time
+	var rejected error
+	// the window preset of every run is resolved relative to its scheduled time
+	for i, runTime := range p.RunTimes {
+		if admit != nil {
+			var usage ReportUsage
+			if err := tx.GetContext(ctx, &usage, reportUsageQuery, schedule.UserID, dayStart); err != nil {
+				return nil, nil, fmt.Errorf("failed to get report usage of user %s: %w", schedule.UserID, err)
+			}
+			if err := admit(&usage); err != nil {
+				rejected = fmt.Errorf("run %s of report schedule %s skipped: %w", runTime.Format(time.RFC3339), schedule.ID, err)
+				continue
+			}
+		}
+
+		var report Report
+		err := transitionTx(ctx, tx, &report, insertQuery,
+			schedule.UserID, runTime, schedule.Timezone, schedule.WindowPreset, schedule.ReportType, string(schedule.Params),
+			schedule.ID, schedule.Format, schedule.Gzip)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			runErr := fmt.Errorf("failed to enqueue run %s of report schedule %s: %w", runTime.Format(time.RFC3339), schedule.ID, err)
+			// the transaction is aborted, the schedule is put off outside of it
+			tx.Rollback()
+			if err := s.db.GetContext(ctx, &schedule, deferQuery, schedule.ID, time.Now().Add(failedRunRetryDelay)); err != nil {
+				return nil, nil, errors.Join(runErr, fmt.Errorf("failed to put off report schedule %s: %w", schedule.ID, err))
+			}
+			return &schedule, nil, runErr
+		}
+		if err == nil {
+			reports = append(reports, report)
+		}
+		lastRunAt = &p.RunTimes[i]
+	}
+
+	if err := tx.GetContext(ctx, &schedule, updateQuery, schedule.ID, p.NextRunAt, lastRunAt); err != nil {
+		return nil, nil, fmt.Errorf("failed to advance report schedule %s: %w", schedule.ID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit report schedule run: %w", err)
+	}
+
+	return &schedule, reports, rejected
+}
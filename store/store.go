@@ -5,11 +5,23 @@ import "database/sql"
 type Store struct {
 	Users             *UsersStore
 	RefreshTokenStore *RefreshTokenStore
+	Reports           *ReportsStore
+	Webhooks          *WebhooksStore
+	Schedules         *SchedulesStore
+	IdempotencyKeys   *IdempotencyKeysStore
+	ReportShares      *ReportSharesStore
+	Outbox            *OutboxStore
 }
 
 func New(db *sql.DB) *Store {
 	return &Store{
 		Users:             NewUserStore(db),
 		RefreshTokenStore: NewRefreshTokenStore(db),
+		Reports:           NewReportsStore(db),
+		Webhooks:          NewWebhooksStore(db),
+		Schedules:         NewSchedulesStore(db),
+		IdempotencyKeys:   NewIdempotencyKeysStore(db),
+		ReportShares:      NewReportSharesStore(db),
+		Outbox:            NewOutboxStore(db),
 	}
 }
@@ -53,9 +53,26 @@ func (s *UsersStore) CreateUser(ctx context.Context, email, password string) (*U
 	}
 	passwordHashB64 := base64.StdEncoding.EncodeToString(bytes)
 
-	if err := s.db.GetContext(ctx, &user, query, email, passwordHashB64); err != nil {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := tx.GetContext(ctx, &user, query, email, passwordHashB64); err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
+	if err := insertOutbox(ctx, tx, OutboxAggregateUser, user.ID, OutboxEventUserCreated, UserCreated{
+		ID:        user.ID,
+		Email:     user.Email,
+		CreatedAt: user.CreatedAt,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit user creation: %w", err)
+	}
 
 	return &user, nil
 }
@@ -81,3 +98,14 @@ func (s *UsersStore) FindByID(ctx context.Context, userId uuid.UUID) (*User, err
 
 	return &user, nil
 }
+
+func (s *UsersStore) ListCreatedBetween(ctx context.Context, from, to time.Time) ([]User, error) {
+	const query = "SELECT * FROM users WHERE created_at >= $1 AND created_at < $2 ORDER BY created_at;"
+
+	users := []User{}
+	if err := s.db.SelectContext(ctx, &users, query, from, to); err != nil {
+		return nil, fmt.Errorf("failed to list users created between %s and %s: %w", from, to, err)
+	}
+
+	return users, nil
+}
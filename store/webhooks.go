@@ -0,0 +1,257 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Webhook events are sent when a report reaches one of its final states.
+const (
+	WebhookEventReportCompleted = "report.completed"
+	WebhookEventReportFailed    = "report.failed"
+	WebhookEventReportDead      = "report.dead"
+	WebhookEventReportCancelled = "report.cancelled"
+)
+
+var WebhookEvents = []string{
+	WebhookEventReportCompleted,
+	WebhookEventReportFailed,
+	WebhookEventReportDead,
+	WebhookEventReportCancelled,
+}
+
+// webhookEvent returns the webhook event sent when a report enters status.
+func webhookEvent(status ReportStatus) (string, bool) {
+	switch status {
+	case ReportStatusCompleted:
+		return WebhookEventReportCompleted, true
+	case ReportStatusFailed:
+		return WebhookEventReportFailed, true
+	case ReportStatusDead:
+		return WebhookEventReportDead, true
+	case ReportStatusCancelled:
+		return WebhookEventReportCancelled, true
+	default:
+		return "", false
+	}
+}
+
+type WebhooksStore struct {
+	db *sqlx.DB
+}
+
+func NewWebhooksStore(db *sql.DB) *WebhooksStore {
+	return &WebhooksStore{
+		db: sqlx.NewDb(db, "postgres"),
+	}
+}
+
+type Webhook struct {
+	ID        uuid.UUID      `db:"id"`
+	UserID    uuid.UUID      `db:"user_id"`
+	Url       string         `db:"url"`
+	Secret    string         `db:"secret"`
+	Events    pq.StringArray `db:"events"`
+	CreatedAt time.Time      `db:"created_at"`
+}
+
+// WebhookDelivery is one event to be sent to a webhook, along with the outcome
+// of the latest attempt.
+type WebhookDelivery struct {
+	ID             int64           `db:"id"`
+	WebhookID      uuid.UUID       `db:"webhook_id"`
+	ReportID       uuid.UUID       `db:"report_id"`
+	Event          string          `db:"event"`
+	Payload        json.RawMessage `db:"payload"`
+	Attempts       int             `db:"attempts"`
+	NextAttemptAt  time.Time       `db:"next_attempt_at"`
+	ResponseStatus *int            `db:"response_status"`
+	LastError      *string         `db:"last_error"`
+	DeliveredAt    *time.Time      `db:"delivered_at"`
+	FailedAt       *time.Time      `db:"failed_at"`
+	CreatedAt      time.Time       `db:"created_at"`
+}
+
+// PendingDelivery is a claimed delivery together with where it has to be sent.
+type PendingDelivery struct {
+	WebhookDelivery
+	Url    string `db:"url"`
+	Secret string `db:"secret"`
+}
+
+// WebhookPayload is the body posted to webhooks.
+type WebhookPayload struct {
+	Event      string             `json:"event"`
+	EventID    int64              `json:"event_id"`
+	OccurredAt time.Time          `json:"occurred_at"`
+	Report     ReportStatusChange `json:"report"`
+}
+
+type ReportStatusChange struct {
+	ID           uuid.UUID    `json:"id"`
+	Type         string       `json:"type"`
+	Status       ReportStatus `json:"status"`
+	ErrorMessage *string      `json:"error_message,omitempty"`
+}
+
+func (s *WebhooksStore) Create(ctx context.Context, userID uuid.UUID, url, secret string, events []string) (*Webhook, error) {
+	const query = "INSERT INTO webhooks (user_id, url, secret, events) VALUES ($1, $2, $3, $4) RETURNING *;"
+
+	var webhook Webhook
+	if err := s.db.GetContext(ctx, &webhook, query, userID, url, secret, pq.Array(events)); err != nil {
+		return nil, fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	return &webhook, nil
+}
+
+func (s *WebhooksStore) ByPrimaryKey(ctx context.Context, userID, webhookID uuid.UUID) (*Webhook, error) {
+	const query = "SELECT * FROM webhooks WHERE user_id = $1 AND id = $2;"
+
+	var webhook Webhook
+	if err := s.db.GetContext(ctx, &webhook, query, userID, webhookID); err != nil {
+		return nil, fmt.Errorf("failed to get webhook %s for user %s: %w", webhookID, userID, err)
+	}
+
+	return &webhook, nil
+}
+
+func (s *WebhooksStore) ListByUser(ctx context.Context, userID uuid.UUID) ([]Webhook, error) {
+	const query = "SELECT * FROM webhooks WHERE user_id = $1 ORDER BY created_at DESC;"
+
+	webhooks := []Webhook{}
+	if err := s.db.SelectContext(ctx, &webhooks, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to list webhooks for user %s: %w", userID, err)
+	}
+
+	return webhooks, nil
+}
+
+// Delete removes a webhook along with its delivery log. sql.ErrNoRows is
+// returned when the user has no such webhook.
+func (s *WebhooksStore) Delete(ctx context.Context, userID, webhookID uuid.UUID) error {
+	const query = "DELETE FROM webhooks WHERE user_id = $1 AND id = $2;"
+
+	res, err := s.db.ExecContext(ctx, query, userID, webhookID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook %s: %w", webhookID, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("failed to delete webhook %s: %w", webhookID, sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// ListDeliveries returns the most recent deliveries of a webhook, newest first.
+func (s *WebhooksStore) ListDeliveries(ctx context.Context, userID, webhookID uuid.UUID, limit int) ([]WebhookDelivery, error) {
+	const query = `SELECT d.* FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+WHERE w.user_id = $1 AND d.webhook_id = $2 ORDER BY d.id DESC LIMIT $3;`
+
+	deliveries := []WebhookDelivery{}
+	if err := s.db.SelectContext(ctx, &deliveries, query, userID, webhookID, limit); err != nil {
+		return nil, fmt.Errorf("failed to list deliveries of webhook %s: %w", webhookID, err)
+	}
+
+	return deliveries, nil
+}
+
+// ClaimDelivery counts an attempt of the oldest delivery that is due and pushes
+// its next attempt back by lease, so it is picked up again if the sender dies
+// before recording the outcome. sql.ErrNoRows is returned when nothing is due.
+func (s *WebhooksStore) ClaimDelivery(ctx context.Context, lease time.Duration) (*PendingDelivery, error) {
+	const query = `WITH claimed AS (
+	UPDATE webhook_deliveries SET attempts = attempts + 1, next_attempt_at = CURRENT_TIMESTAMP + $1 * INTERVAL '1 millisecond'
+	WHERE id = (
+		SELECT id FROM webhook_deliveries
+		WHERE delivered_at IS NULL AND failed_at IS NULL AND next_attempt_at <= CURRENT_TIMESTAMP
+		ORDER BY next_attempt_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING *
+)
+SELECT claimed.*, w.url, w.secret FROM claimed JOIN webhooks w ON w.id = claimed.webhook_id;`
+
+	var delivery PendingDelivery
+	if err := s.db.GetContext(ctx, &delivery, query, lease.Milliseconds()); err != nil {
+		return nil, fmt.Errorf("failed to claim webhook delivery: %w", err)
+	}
+
+	return &delivery, nil
+}
+
+func (s *WebhooksStore) MarkDelivered(ctx context.Context, deliveryID int64, responseStatus int) error {
+	const query = `UPDATE webhook_deliveries SET delivered_at = CURRENT_TIMESTAMP, response_status = $2, last_error = NULL
+WHERE id = $1;`
+
+	if _, err := s.db.ExecContext(ctx, query, deliveryID, responseStatus); err != nil {
+		return fmt.Errorf("failed to mark webhook delivery %d as delivered: %w", deliveryID, err)
+	}
+
+	return nil
+}
+
+// RetryDelivery records a failed attempt and schedules the next one.
+func (s *WebhooksStore) RetryDelivery(ctx context.Context, deliveryID int64, responseStatus *int, lastError string, nextAttemptAt time.Time) error {
+	const query = `UPDATE webhook_deliveries SET response_status = $2, last_error = $3, next_attempt_at = $4
+WHERE id = $1;`
+
+	if _, err := s.db.ExecContext(ctx, query, deliveryID, responseStatus, lastError, nextAttemptAt); err != nil {
+		return fmt.Errorf("failed to schedule retry of webhook delivery %d: %w", deliveryID, err)
+	}
+
+	return nil
+}
+
+// FailDelivery gives up on a delivery that ran out of attempts.
+func (s *WebhooksStore) FailDelivery(ctx context.Context, deliveryID int64, responseStatus *int, lastError string) error {
+	const query = `UPDATE webhook_deliveries SET failed_at = CURRENT_TIMESTAMP, response_status = $2, last_error = $3
+WHERE id = $1;`
+
+	if _, err := s.db.ExecContext(ctx, query, deliveryID, responseStatus, lastError); err != nil {
+		return fmt.Errorf("failed to mark webhook delivery %d as failed: %w", deliveryID, err)
+	}
+
+	return nil
+}
+
+// enqueueWebhookDeliveries queues the event for every webhook of the report owner
+// subscribed to it and returns how many deliveries were queued.
+func enqueueWebhookDeliveries(ctx context.Context, tx *sqlx.Tx, report *Report, event *ReportEvent) (int64, error) {
+	const query = `INSERT INTO webhook_deliveries (webhook_id, report_id, event, payload)
+SELECT id, $2, $3, $4 FROM webhooks WHERE user_id = $1 AND $3::varchar = ANY(events);`
+
+	name, ok := webhookEvent(event.Status)
+	if !ok {
+		return 0, nil
+	}
+
+	payload, err := json.Marshal(WebhookPayload{
+		Event:      name,
+		EventID:    event.ID,
+		OccurredAt: event.CreatedAt,
+		Report: ReportStatusChange{
+			ID:           report.ID,
+			Type:         report.ReportType,
+			Status:       event.Status,
+			ErrorMessage: report.ErrorMessage,
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	res, err := tx.ExecContext(ctx, query, report.UserID, report.ID, name, string(payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to queue webhook deliveries: %w", err)
+	}
+
+	return res.RowsAffected()
+}
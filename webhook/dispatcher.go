@@ -0,0 +1,174 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/astroniumm/go-asyncapi/config"
+	"github.com/astroniumm/go-asyncapi/retry"
+	"github.com/astroniumm/go-asyncapi/store"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const userAgent = "go-asyncapi-webhooks/1.0"
+
+// Deliveries is the delivery queue the dispatcher works off.
+type Deliveries interface {
+	ClaimDelivery(ctx context.Context, lease time.Duration) (*store.PendingDelivery, error)
+	MarkDelivered(ctx context.Context, deliveryID int64, responseStatus int) error
+	RetryDelivery(ctx context.Context, deliveryID int64, responseStatus *int, lastError string, nextAttemptAt time.Time) error
+	FailDelivery(ctx context.Context, deliveryID int64, responseStatus *int, lastError string) error
+}
+
+// Dispatcher posts queued webhook deliveries, retrying failed ones with backoff.
+type Dispatcher struct {
+	config     *config.Config
+	logger     *slog.Logger
+	deliveries Deliveries
+	client     *http.Client
+	policy     retry.Policy
+	wake       chan struct{}
+}
+
+func NewDispatcher(config *config.Config, logger *slog.Logger, deliveries Deliveries) *Dispatcher {
+	return &Dispatcher{
+		config:     config,
+		logger:     logger,
+		deliveries: deliveries,
+		client:     newClient(config),
+		policy: retry.Policy{
+			MaxAttempts: config.WebhookMaxAttempts,
+			Backoff:     config.WebhookRetryBackoff,
+			MaxBackoff:  config.WebhookRetryMaxBackoff,
+		},
+		wake: make(chan struct{}, max(config.WebhookConcurrency, 1)),
+	}
+}
+
+// Wake makes idle senders look for queued deliveries right away.
+func (d *Dispatcher) Wake() {
+	for i := 0; i < cap(d.wake); i++ {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+			return
+		}
+	}
+}
+
+// Run sends due deliveries until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for i := 0; i < max(d.config.WebhookConcurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.loop(ctx)
+		}()
+	}
+	wg.Wait()
+
+	return nil
+}
+
+func (d *Dispatcher) loop(ctx context.Context) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		// a claimed delivery is retried once the lease runs out if its outcome is never recorded
+		delivery, err := d.deliveries.ClaimDelivery(ctx, 2*d.config.WebhookTimeout)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) && ctx.Err() == nil {
+				d.logger.Error("failed to claim webhook delivery", "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-d.wake:
+			case <-time.After(d.config.WebhookPollInterval):
+			}
+			continue
+		}
+
+		d.Deliver(ctx, delivery)
+	}
+}
+
+// Deliver sends a claimed delivery and records the outcome.
+func (d *Dispatcher) Deliver(ctx context.Context, delivery *store.PendingDelivery) {
+	logger := d.logger.With("delivery_id", delivery.ID, "webhook_id", delivery.WebhookID, "event", delivery.Event)
+
+	status, err := d.send(ctx, delivery)
+
+	recordCtx, cancelRecord := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancelRecord()
+
+	if err == nil {
+		if err := d.deliveries.MarkDelivered(recordCtx, delivery.ID, status); err != nil {
+			logger.Error("failed to record webhook delivery", "error", err)
+		}
+		return
+	}
+
+	var responseStatus *int
+	if status != 0 {
+		responseStatus = &status
+	}
+
+	if !d.policy.CanRetry(delivery.Attempts) {
+		if err := d.deliveries.FailDelivery(recordCtx, delivery.ID, responseStatus, err.Error()); err != nil {
+			logger.Error("failed to record webhook delivery failure", "error", err)
+			return
+		}
+		logger.Error("webhook delivery ran out of attempts", "error", err, "attempt", delivery.Attempts)
+		return
+	}
+
+	nextAttemptAt := time.Now().Add(d.policy.Delay(delivery.Attempts))
+	if err := d.deliveries.RetryDelivery(recordCtx, delivery.ID, responseStatus, err.Error(), nextAttemptAt); err != nil {
+		logger.Error("failed to schedule webhook delivery retry", "error", err)
+		return
+	}
+	logger.Warn("webhook delivery failed, retry scheduled", "error", err, "attempt", delivery.Attempts, "next_attempt_at", nextAttemptAt)
+}
+
+// send posts the signed payload and returns the response status, which is 0 when
+// no response was received. Any status other than 2xx is an error.
+func (d *Dispatcher) send(ctx context.Context, delivery *store.PendingDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(HeaderDeliveryID, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderEvent, delivery.Event)
+	now := time.Now()
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, now, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// drain a bit of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
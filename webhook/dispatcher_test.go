@@ -0,0 +1,192 @@
+package webhook_test
+
+import (
+	"context"
+	"github.com/astroniumm/go-asyncapi/config"
+	"github.com/astroniumm/go-asyncapi/store"
+	"github.com/astroniumm/go-asyncapi/webhook"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type outcome struct {
+	delivered      bool
+	failed         bool
+	responseStatus *int
+	lastError      string
+	nextAttemptAt  time.Time
+}
+
+// fakeDeliveries records the outcomes reported by the dispatcher.
+type fakeDeliveries struct {
+	mu       sync.Mutex
+	outcomes map[int64]outcome
+}
+
+func (f *fakeDeliveries) ClaimDelivery(context.Context, time.Duration) (*store.PendingDelivery, error) {
+	panic("not used")
+}
+
+func (f *fakeDeliveries) MarkDelivered(_ context.Context, deliveryID int64, responseStatus int) error {
+	f.record(deliveryID, outcome{delivered: true, responseStatus: &responseStatus})
+	return nil
+}
+
+func (f *fakeDeliveries) RetryDelivery(_ context.Context, deliveryID int64, responseStatus *int, lastError string, nextAttemptAt time.Time) error {
+	f.record(deliveryID, outcome{responseStatus: responseStatus, lastError: lastError, nextAttemptAt: nextAttemptAt})
+	return nil
+}
+
+func (f *fakeDeliveries) FailDelivery(_ context.Context, deliveryID int64, responseStatus *int, lastError string) error {
+	f.record(deliveryID, outcome{failed: true, responseStatus: responseStatus, lastError: lastError})
+	return nil
+}
+
+func (f *fakeDeliveries) record(deliveryID int64, o outcome) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.outcomes == nil {
+		f.outcomes = map[int64]outcome{}
+	}
+	f.outcomes[deliveryID] = o
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func newReceiver(t *testing.T, status int) (*httptest.Server, <-chan receivedRequest) {
+	received := make(chan receivedRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		received <- receivedRequest{header: r.Header.Clone(), body: body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, received
+}
+
+func newDispatcher(deliveries webhook.Deliveries) *webhook.Dispatcher {
+	return webhook.NewDispatcher(&config.Config{
+		Env:                    config.Env_Test,
+		WebhookConcurrency:     1,
+		WebhookTimeout:         time.Second,
+		WebhookMaxAttempts:     3,
+		WebhookRetryBackoff:    time.Minute,
+		WebhookRetryMaxBackoff: time.Hour,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)), deliveries)
+}
+
+func pendingDelivery(url string, attempts int) *store.PendingDelivery {
+	return &store.PendingDelivery{
+		WebhookDelivery: store.WebhookDelivery{
+			ID:        42,
+			WebhookID: uuid.New(),
+			ReportID:  uuid.New(),
+			Event:     store.WebhookEventReportCompleted,
+			Payload:   []byte(`{"event":"report.completed"}`),
+			Attempts:  attempts,
+		},
+		Url:    url,
+		Secret: "whsec_test",
+	}
+}
+
+func TestDispatcherDeliversSignedPayload(t *testing.T) {
+	srv, received := newReceiver(t, http.StatusNoContent)
+	deliveries := &fakeDeliveries{}
+
+	delivery := pendingDelivery(srv.URL, 1)
+	newDispatcher(deliveries).Deliver(context.Background(), delivery)
+
+	req := <-received
+	require.Equal(t, "42", req.header.Get(webhook.HeaderDeliveryID))
+	require.Equal(t, store.WebhookEventReportCompleted, req.header.Get(webhook.HeaderEvent))
+	require.Equal(t, "application/json", req.header.Get("Content-Type"))
+	require.JSONEq(t, string(delivery.Payload), string(req.body))
+	require.NoError(t, webhook.Verify("whsec_test", req.header.Get(webhook.HeaderTimestamp),
+		req.header.Get(webhook.HeaderSignature), req.body, time.Now(), time.Minute))
+
+	result := deliveries.outcomes[42]
+	require.True(t, result.delivered)
+	require.Equal(t, http.StatusNoContent, *result.responseStatus)
+}
+
+func TestDispatcherRetriesFailedDelivery(t *testing.T) {
+	srv, received := newReceiver(t, http.StatusServiceUnavailable)
+	deliveries := &fakeDeliveries{}
+
+	newDispatcher(deliveries).Deliver(context.Background(), pendingDelivery(srv.URL, 2))
+	<-received
+
+	result := deliveries.outcomes[42]
+	require.False(t, result.delivered)
+	require.False(t, result.failed)
+	require.Equal(t, http.StatusServiceUnavailable, *result.responseStatus)
+	require.Contains(t, result.lastError, "503")
+	// the second attempt waits twice the backoff
+	require.WithinDuration(t, time.Now().Add(2*time.Minute), result.nextAttemptAt, 5*time.Second)
+}
+
+func TestDispatcherGivesUpAfterMaxAttempts(t *testing.T) {
+	srv, received := newReceiver(t, http.StatusInternalServerError)
+	deliveries := &fakeDeliveries{}
+
+	newDispatcher(deliveries).Deliver(context.Background(), pendingDelivery(srv.URL, 3))
+	<-received
+
+	result := deliveries.outcomes[42]
+	require.True(t, result.failed)
+	require.Equal(t, http.StatusInternalServerError, *result.responseStatus)
+}
+
+func TestDispatcherRetriesUnreachableReceiver(t *testing.T) {
+	srv, _ := newReceiver(t, http.StatusOK)
+	srv.Close()
+	deliveries := &fakeDeliveries{}
+
+	newDispatcher(deliveries).Deliver(context.Background(), pendingDelivery(srv.URL, 1))
+
+	result := deliveries.outcomes[42]
+	require.False(t, result.failed)
+	require.Nil(t, result.responseStatus)
+	require.NotEmpty(t, result.lastError)
+}
+
+func TestDispatcherRefusesPrivateReceiver(t *testing.T) {
+	srv, received := newReceiver(t, http.StatusOK)
+	deliveries := &fakeDeliveries{}
+
+	dispatcher := webhook.NewDispatcher(&config.Config{
+		Env:                 "production",
+		WebhookConcurrency:  1,
+		WebhookTimeout:      time.Second,
+		WebhookMaxAttempts:  3,
+		WebhookRetryBackoff: time.Minute,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)), deliveries)
+	dispatcher.Deliver(context.Background(), pendingDelivery(srv.URL, 1))
+
+	require.Empty(t, received)
+	require.Contains(t, deliveries.outcomes[42].lastError, webhook.ErrForbiddenTarget.Error())
+}
+
+func TestDispatcherDoesNotFollowRedirects(t *testing.T) {
+	target, received := newReceiver(t, http.StatusOK)
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	t.Cleanup(redirect.Close)
+	deliveries := &fakeDeliveries{}
+
+	newDispatcher(deliveries).Deliver(context.Background(), pendingDelivery(redirect.URL, 1))
+
+	require.Empty(t, received)
+	require.Equal(t, http.StatusTemporaryRedirect, *deliveries.outcomes[42].responseStatus)
+}
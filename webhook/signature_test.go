@@ -0,0 +1,34 @@
+package webhook_test
+
+import (
+	"github.com/astroniumm/go-asyncapi/webhook"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"event":"report.failed"}`)
+	signature := webhook.Sign("secret", now, body)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	require.NoError(t, webhook.Verify("secret", timestamp, signature, body, now, time.Minute))
+	require.ErrorIs(t, webhook.Verify("other", timestamp, signature, body, now, time.Minute), webhook.ErrInvalidSignature)
+	require.ErrorIs(t, webhook.Verify("secret", timestamp, signature, []byte(`{}`), now, time.Minute), webhook.ErrInvalidSignature)
+	require.ErrorIs(t, webhook.Verify("secret", timestamp, "not-a-signature", body, now, time.Minute), webhook.ErrInvalidSignature)
+	require.ErrorIs(t, webhook.Verify("secret", "yesterday", signature, body, now, time.Minute), webhook.ErrInvalidSignature)
+	require.ErrorIs(t, webhook.Verify("secret", timestamp, signature, body, now.Add(time.Hour), time.Minute), webhook.ErrStaleTimestamp)
+}
+
+func TestNewSecret(t *testing.T) {
+	a, err := webhook.NewSecret()
+	require.NoError(t, err)
+	b, err := webhook.NewSecret()
+	require.NoError(t, err)
+
+	require.True(t, strings.HasPrefix(a, "whsec_"))
+	require.NotEqual(t, a, b)
+}
@@ -0,0 +1,107 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"github.com/astroniumm/go-asyncapi/config"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// ErrForbiddenTarget is returned for webhook urls that point into the network
+// the service runs in, e.g. at loopback, private or cloud metadata addresses.
+var ErrForbiddenTarget = errors.New("webhook target is not a public address")
+
+// forbiddenPrefixes are reserved ranges that netip does not classify as
+// private: "this network", which reaches the host itself, and carrier-grade NAT.
+var forbiddenPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+// AllowsPrivateTargets reports whether webhooks may be sent over plain http
+// and to private addresses, which is only the case in development and tests.
+func AllowsPrivateTargets(conf *config.Config) bool {
+	return conf.Env == config.Env_Dev || conf.Env == config.Env_Test
+}
+
+// CheckURL validates the url a webhook is registered with. Outside development
+// it must use https and must not name a private address. Host names are
+// checked again once resolved, when deliveries are sent.
+func CheckURL(rawURL string, allowPrivate bool) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https url")
+	}
+	if allowPrivate {
+		return nil
+	}
+
+	if u.Scheme != "https" {
+		return errors.New("url must be an https url")
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrForbiddenTarget
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && forbiddenAddr(addr) {
+		return ErrForbiddenTarget
+	}
+
+	return nil
+}
+
+// forbiddenAddr reports whether addr is not a public unicast address. Loopback,
+// link local addresses such as the metadata endpoint 169.254.169.254, multicast
+// and unspecified addresses are not global unicast.
+func forbiddenAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return true
+	}
+	for _, prefix := range forbiddenPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// dialControl refuses connections to forbidden addresses. It runs after name
+// resolution, so host names that resolve to private addresses, e.g. through DNS
+// rebinding, are caught as well.
+func dialControl(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("failed to parse dialed address %q: %w", address, err)
+	}
+	if forbiddenAddr(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrForbiddenTarget, addrPort.Addr())
+	}
+	return nil
+}
+
+// newClient returns the client deliveries are sent with. Redirects are not
+// followed, a webhook has to answer at the url it was registered with.
+func newClient(conf *config.Config) *http.Client {
+	dialer := &net.Dialer{Timeout: conf.WebhookTimeout}
+	if !AllowsPrivateTargets(conf) {
+		dialer.Control = dialControl
+	}
+
+	return &http.Client{
+		Timeout: conf.WebhookTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: conf.WebhookTimeout,
+			MaxIdleConnsPerHost: max(conf.WebhookConcurrency, 1),
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
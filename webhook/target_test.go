@@ -0,0 +1,35 @@
+package webhook_test
+
+import (
+	"github.com/astroniumm/go-asyncapi/webhook"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCheckURL(t *testing.T) {
+	require.NoError(t, webhook.CheckURL("https://example.com/hooks", false))
+	require.NoError(t, webhook.CheckURL("https://93.184.216.34/hooks", false))
+
+	for _, url := range []string{
+		"http://example.com/hooks",
+		"https://localhost/hooks",
+		"https://127.0.0.1/hooks",
+		"https://[::1]/hooks",
+		"https://10.0.0.5/hooks",
+		"https://172.16.3.4/hooks",
+		"https://192.168.1.1/hooks",
+		"https://169.254.169.254/latest/meta-data",
+		"https://[fe80::1]/hooks",
+		"https://[::ffff:127.0.0.1]/hooks",
+		"https://0.0.0.0/hooks",
+		"https://100.64.0.1/hooks",
+		"ftp://example.com/hooks",
+		"/hooks",
+	} {
+		require.Error(t, webhook.CheckURL(url, false), url)
+	}
+
+	// development may send to local receivers over plain http
+	require.NoError(t, webhook.CheckURL("http://localhost:8080/hooks", true))
+	require.Error(t, webhook.CheckURL("ftp://localhost/hooks", true))
+}
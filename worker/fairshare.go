@@ -0,0 +1,60 @@
+package worker
+
+import (
+	"bytes"
+	"cmp"
+	"github.com/astroniumm/go-asyncapi/config"
+	"github.com/astroniumm/go-asyncapi/store"
+	"slices"
+)
+
+// FairShare decides which due report is claimed next. Priorities get turns in
+// proportion to their weight from REPORT_PRIORITY_WEIGHTS, so that lower
+// priorities still progress while higher ones are busy, and within a priority
+// the user with the fewest recent claims goes first, so a user with a long
+// backlog cannot starve others.
+type FairShare struct {
+	weights map[string]int
+}
+
+func NewFairShare(config *config.Config) *FairShare {
+	return &FairShare{
+		weights: config.ReportPriorityWeights,
+	}
+}
+
+func (f *FairShare) weight(priority string) int {
+	// unknown priorities still get a share
+	return max(f.weights[priority], 1)
+}
+
+// Order sorts candidates in the order they should be claimed.
+func (f *FairShare) Order(candidates []store.QueueCandidate) []store.QueueCandidate {
+	ordered := slices.Clone(candidates)
+	slices.SortFunc(ordered, func(a, b store.QueueCandidate) int {
+		if a.Priority != b.Priority {
+			// the priority whose next claim puts it least ahead of its share goes
+			// first: (claims+1)/weight compared without dividing
+			wa, wb := int64(f.weight(a.Priority)), int64(f.weight(b.Priority))
+			if c := cmp.Compare((a.PriorityClaims+1)*wb, (b.PriorityClaims+1)*wa); c != 0 {
+				return c
+			}
+			if c := cmp.Compare(wb, wa); c != 0 {
+				return c
+			}
+			return cmp.Compare(a.Priority, b.Priority)
+		}
+		if c := cmp.Compare(a.UserClaims, b.UserClaims); c != 0 {
+			return c
+		}
+		if c := a.NextAttemptAt.Compare(b.NextAttemptAt); c != 0 {
+			return c
+		}
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return bytes.Compare(a.ID[:], b.ID[:])
+	})
+
+	return ordered
+}
@@ -0,0 +1,152 @@
+package worker_test
+
+import (
+	"github.com/astroniumm/go-asyncapi/config"
+	"github.com/astroniumm/go-asyncapi/store"
+	"github.com/astroniumm/go-asyncapi/worker"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// queue simulates the reports table: due reports per priority and user, and
+// the claims counted by QueueCandidates.
+type queue struct {
+	start   time.Time
+	backlog map[string]map[uuid.UUID]int
+	claims  map[string]map[uuid.UUID]int64
+}
+
+func newQueue() *queue {
+	return &queue{
+		start:   time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		backlog: map[string]map[uuid.UUID]int{},
+		claims:  map[string]map[uuid.UUID]int64{},
+	}
+}
+
+func (q *queue) submit(priority string, user uuid.UUID, n int) {
+	if q.backlog[priority] == nil {
+		q.backlog[priority] = map[uuid.UUID]int{}
+		q.claims[priority] = map[uuid.UUID]int64{}
+	}
+	q.backlog[priority][user] += n
+}
+
+func (q *queue) candidates() []store.QueueCandidate {
+	var candidates []store.QueueCandidate
+	for priority, users := range q.backlog {
+		var priorityClaims int64
+		for _, claims := range q.claims[priority] {
+			priorityClaims += claims
+		}
+		for user, n := range users {
+			if n == 0 {
+				continue
+			}
+			candidates = append(candidates, store.QueueCandidate{
+				UserID:         user,
+				ID:             uuid.New(),
+				Priority:       priority,
+				NextAttemptAt:  q.start,
+				CreatedAt:      q.start,
+				UserClaims:     q.claims[priority][user],
+				PriorityClaims: priorityClaims,
+			})
+		}
+	}
+	return candidates
+}
+
+// claim claims the first candidate in the order of fair and returns it.
+func (q *queue) claim(t *testing.T, fair *worker.FairShare) store.QueueCandidate {
+	ordered := fair.Order(q.candidates())
+	require.NotEmpty(t, ordered)
+
+	next := ordered[0]
+	q.backlog[next.Priority][next.UserID]--
+	q.claims[next.Priority][next.UserID]++
+	return next
+}
+
+func TestFairShareHeavyUserCannotStarveOthers(t *testing.T) {
+	fair := worker.NewFairShare(&config.Config{})
+	q := newQueue()
+
+	heavy := uuid.New()
+	q.submit(store.ReportPriorityNormal, heavy, 500)
+	// the heavy user has been busy already
+	for i := 0; i < 20; i++ {
+		q.claim(t, fair)
+	}
+
+	light := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	for _, user := range light {
+		q.submit(store.ReportPriorityNormal, user, 2)
+	}
+
+	// every light user gets both reports claimed before the heavy user gets another turn
+	for i := 0; i < 2*len(light); i++ {
+		require.NotEqual(t, heavy, q.claim(t, fair).UserID)
+	}
+	require.Equal(t, heavy, q.claim(t, fair).UserID)
+}
+
+func TestFairShareRoundRobin(t *testing.T) {
+	fair := worker.NewFairShare(&config.Config{})
+	q := newQueue()
+
+	users := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	q.submit(store.ReportPriorityNormal, users[0], 100)
+	q.submit(store.ReportPriorityNormal, users[1], 100)
+	q.submit(store.ReportPriorityNormal, users[2], 1)
+
+	claimed := map[uuid.UUID]int{}
+	for i := 0; i < 21; i++ {
+		claimed[q.claim(t, fair).UserID]++
+	}
+
+	require.Equal(t, 10, claimed[users[0]])
+	require.Equal(t, 10, claimed[users[1]])
+	require.Equal(t, 1, claimed[users[2]])
+}
+
+func TestFairShareWeights(t *testing.T) {
+	fair := worker.NewFairShare(&config.Config{
+		ReportPriorityWeights: map[string]int{
+			store.ReportPriorityHigh:   8,
+			store.ReportPriorityNormal: 4,
+			store.ReportPriorityLow:    1,
+		},
+	})
+	q := newQueue()
+
+	q.submit(store.ReportPriorityHigh, uuid.New(), 1000)
+	q.submit(store.ReportPriorityNormal, uuid.New(), 1000)
+	q.submit(store.ReportPriorityLow, uuid.New(), 1000)
+
+	// high priority goes first
+	require.Equal(t, store.ReportPriorityHigh, q.claim(t, fair).Priority)
+
+	claimed := map[string]int{store.ReportPriorityHigh: 1}
+	for i := 1; i < 130; i++ {
+		claimed[q.claim(t, fair).Priority]++
+	}
+
+	require.Equal(t, 80, claimed[store.ReportPriorityHigh])
+	require.Equal(t, 40, claimed[store.ReportPriorityNormal])
+	require.Equal(t, 10, claimed[store.ReportPriorityLow])
+}
+
+func TestFairShareIdlePriorityDoesNotBlock(t *testing.T) {
+	fair := worker.NewFairShare(&config.Config{
+		ReportPriorityWeights: map[string]int{store.ReportPriorityHigh: 8, store.ReportPriorityLow: 1},
+	})
+	q := newQueue()
+
+	q.submit(store.ReportPriorityLow, uuid.New(), 5)
+	for i := 0; i < 5; i++ {
+		require.Equal(t, store.ReportPriorityLow, q.claim(t, fair).Priority)
+	}
+}
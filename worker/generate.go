@@ -0,0 +1,144 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/astroniumm/go-asyncapi/config"
+	"github.com/astroniumm/go-asyncapi/report"
+	"github.com/astroniumm/go-asyncapi/storage"
+	"github.com/astroniumm/go-asyncapi/store"
+	"io"
+	"log/slog"
+)
+
+// GeneratorProcessor runs the registered generator of a report's type, renders
+// its rows in the requested output format and uploads the result to blob storage.
+type GeneratorProcessor struct {
+	config   *config.Config
+	logger   *slog.Logger
+	registry *report.Registry
+	blob     storage.Blob
+	reports  *store.ReportsStore
+}
+
+func NewGeneratorProcessor(config *config.Config, logger *slog.Logger, registry *report.Registry, blob storage.Blob, reports *store.ReportsStore) *GeneratorProcessor {
+	return &GeneratorProcessor{
+		config:   config,
+		logger:   logger,
+		registry: registry,
+		blob:     blob,
+		reports:  reports,
+	}
+}
+
+// OutputKey is the storage key the output of a report is written to.
+func OutputKey(r *store.Report) string {
+	return r.UserID.String() + "/" + r.ID.String()
+}
+
+func (p *GeneratorProcessor) Process(ctx context.Context, r *store.Report) error {
+	generator, err := p.registry.Get(r.ReportType)
+	if err != nil {
+		return err
+	}
+
+	format, err := report.ParseFormat(r.Format)
+	if err != nil {
+		return report.Permanent(err)
+	}
+	output := report.Output{Format: format, Gzip: r.Gzip}
+
+	window, err := p.window(ctx, r)
+	if err != nil {
+		return err
+	}
+	req := report.Request{Params: r.Params, Window: window}
+
+	pr, pw := io.Pipe()
+	counter := &countingWriter{w: pw}
+	progress := NewProgressTracker(ctx, p.logger, p.reports, r, p.config.ReportProgressInterval)
+	generateErr := make(chan error, 1)
+	go func() {
+		err := generate(ctx, generator, req, output, counter, progress)
+		pw.CloseWithError(err)
+		generateErr <- err
+	}()
+
+	key := OutputKey(r)
+	putErr := p.blob.Put(ctx, key, pr)
+	// unblock the generator if the upload gave up before reading everything
+	pr.CloseWithError(putErr)
+
+	err = <-generateErr
+	progress.Flush()
+
+	// a failing generator also fails the upload, report the original cause
+	if err != nil && (putErr == nil || errors.Is(putErr, err)) {
+		return err
+	}
+	if putErr != nil {
+		return fmt.Errorf("storing report output: %w", putErr)
+	}
+
+	if err := p.reports.SetOutput(ctx, r.UserID, r.ID, leaseHolder(r), key, counter.n, output.ContentType(), output.Extension()); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %w", ErrLeaseLost, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// window returns the time range of a report. A preset is resolved relative to
+// when the report was scheduled for or submitted the first time it runs, and
+// kept for its retries.
+func (p *GeneratorProcessor) window(ctx context.Context, r *store.Report) (report.Window, error) {
+	stored := r.ReportWindow
+	if stored.Start == nil || stored.End == nil {
+		if stored.Preset == nil {
+			return report.Window{}, report.Permanent(errors.New("report has neither a window nor a window preset"))
+		}
+
+		now := r.CreatedAt
+		if r.ScheduledAt != nil {
+			now = *r.ScheduledAt
+		}
+		resolved, err := report.WindowSpec{Preset: *stored.Preset, Timezone: stored.Timezone}.Resolve(now)
+		if err != nil {
+			return report.Window{}, report.Permanent(err)
+		}
+
+		w, err := p.reports.ResolveWindow(ctx, r.UserID, r.ID, resolved.Start, resolved.End)
+		if err != nil {
+			return report.Window{}, err
+		}
+		stored = *w
+	}
+
+	return report.Window{Start: *stored.Start, End: *stored.End, Timezone: stored.Timezone}, nil
+}
+
+func generate(ctx context.Context, generator report.ReportGenerator, req report.Request, output report.Output, w io.Writer, progress report.ProgressReporter) error {
+	enc, err := output.NewEncoder(w)
+	if err != nil {
+		return report.Permanent(err)
+	}
+	if err := generator.Generate(ctx, req, enc, progress); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
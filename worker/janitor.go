@@ -0,0 +1,162 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"expvar"
+	"github.com/astroniumm/go-asyncapi/config"
+	"github.com/astroniumm/go-asyncapi/storage"
+	"github.com/astroniumm/go-asyncapi/store"
+	"github.com/google/uuid"
+	"log/slog"
+	"time"
+)
+
+// janitorMetrics are published under "report_janitor" in /debug/vars.
+var janitorMetrics = expvar.NewMap("report_janitor")
+
+// ExpiringReports is where the janitor finds and expires report outputs.
+type ExpiringReports interface {
+	ExpiredOutputs(ctx context.Context, defaultRetention time.Duration, retentionByType map[string]time.Duration, limit int) ([]store.Report, error)
+	ExpireReport(ctx context.Context, userID, reportID uuid.UUID) (*store.Report, error)
+}
+
+// ExpiringIdempotencyKeys is where the janitor forgets idempotency keys.
+type ExpiringIdempotencyKeys interface {
+	DeleteCreatedBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Janitor deletes report outputs that outlived the retention of their report type
+// and marks the reports as expired. It also forgets idempotency keys past their TTL.
+type Janitor struct {
+	config          *config.Config
+	logger          *slog.Logger
+	reports         ExpiringReports
+	idempotencyKeys ExpiringIdempotencyKeys
+	blob            storage.Blob
+}
+
+func NewJanitor(config *config.Config, logger *slog.Logger, reports ExpiringReports, idempotencyKeys ExpiringIdempotencyKeys, blob storage.Blob) *Janitor {
+	return &Janitor{
+		config:          config,
+		logger:          logger,
+		reports:         reports,
+		idempotencyKeys: idempotencyKeys,
+		blob:            blob,
+	}
+}
+
+// Run purges expired outputs every JanitorInterval until ctx is cancelled.
+func (j *Janitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(j.config.JanitorInterval)
+	defer ticker.Stop()
+
+	for {
+		j.Purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge expires the outputs past their retention and the idempotency keys past
+// their TTL once.
+func (j *Janitor) Purge(ctx context.Context) {
+	j.purgeOutputs(ctx)
+	j.purgeIdempotencyKeys(ctx)
+}
+
+func (j *Janitor) purgeOutputs(ctx context.Context) {
+	start := time.Now()
+	var expired, failed, bytes int64
+
+	for ctx.Err() == nil {
+		reports, err := j.reports.ExpiredOutputs(ctx, j.config.ReportRetention, j.config.ReportRetentionByType, max(j.config.JanitorBatchSize, 1))
+		if err != nil {
+			if ctx.Err() == nil {
+				j.logger.Error("failed to list expired report outputs", "error", err)
+			}
+			break
+		}
+
+		progressed := false
+		for i := range reports {
+			size, err := j.expire(ctx, &reports[i])
+			if err != nil {
+				failed++
+				j.logger.Error("failed to purge report output", "error", err, "report_id", reports[i].ID, "user_id", reports[i].UserID)
+				continue
+			}
+			progressed = true
+			expired++
+			bytes += size
+		}
+
+		// a batch that failed entirely would be listed again right away
+		if len(reports) < j.config.JanitorBatchSize || !progressed {
+			break
+		}
+	}
+
+	janitorMetrics.Add("runs", 1)
+	janitorMetrics.Add("reports_expired", expired)
+	janitorMetrics.Add("bytes_purged", bytes)
+	janitorMetrics.Add("errors", failed)
+	lastRun := new(expvar.String)
+	lastRun.Set(start.UTC().Format(time.RFC3339))
+	janitorMetrics.Set("last_run_at", lastRun)
+
+	j.logger.Info("report janitor run finished", "reports_expired", expired, "bytes_purged", bytes,
+		"errors", failed, "duration", time.Since(start))
+}
+
+func (j *Janitor) purgeIdempotencyKeys(ctx context.Context) {
+	deleted, err := j.idempotencyKeys.DeleteCreatedBefore(ctx, time.Now().Add(-j.config.IdempotencyKeyTTL))
+	if err != nil {
+		if ctx.Err() == nil {
+			j.logger.Error("failed to purge idempotency keys", "error", err)
+		}
+		return
+	}
+
+	janitorMetrics.Add("idempotency_keys_deleted", deleted)
+	if deleted > 0 {
+		j.logger.Info("expired idempotency keys deleted", "count", deleted)
+	}
+}
+
+// expire deletes the output of a report and marks the report as expired. It
+// returns the size of the deleted output.
+func (j *Janitor) expire(ctx context.Context, r *store.Report) (int64, error) {
+	key := *r.OutputFilePath
+
+	var size int64
+	info, err := j.blob.Stat(ctx, key)
+	switch {
+	case err == nil:
+		size = info.Size
+	case !errors.Is(err, storage.ErrNotFound):
+		return 0, err
+	}
+
+	if err := j.blob.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return 0, err
+	}
+
+	if _, err := j.reports.ExpireReport(ctx, r.UserID, r.ID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// expired by another replica in the meantime
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	j.logger.Info("report output expired", "report_id", r.ID, "user_id", r.UserID, "report_type", r.ReportType,
+		"key", key, "bytes", size)
+
+	return size, nil
+}
@@ -0,0 +1,167 @@
+package worker_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"expvar"
+	"fmt"
+	"github.com/astroniumm/go-asyncapi/config"
+	"github.com/astroniumm/go-asyncapi/storage"
+	"github.com/astroniumm/go-asyncapi/store"
+	"github.com/astroniumm/go-asyncapi/worker"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// memoryBlob keeps objects in memory, Delete can be made to fail for a key.
+type memoryBlob struct {
+	objects   map[string][]byte
+	failOnKey string
+}
+
+func (b *memoryBlob) Put(_ context.Context, key string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	b.objects[key] = data
+	return nil
+}
+
+func (b *memoryBlob) Get(_ context.Context, key string) (io.ReadSeekCloser, error) {
+	data, ok := b.objects[key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return nopSeekCloser{bytes.NewReader(data)}, nil
+}
+
+func (b *memoryBlob) Delete(_ context.Context, key string) error {
+	if key == b.failOnKey {
+		return errors.New("storage unavailable")
+	}
+	if _, ok := b.objects[key]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(b.objects, key)
+	return nil
+}
+
+func (b *memoryBlob) Stat(_ context.Context, key string) (*storage.ObjectInfo, error) {
+	data, ok := b.objects[key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return &storage.ObjectInfo{Key: key, Size: int64(len(data))}, nil
+}
+
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error { return nil }
+
+// expiringReports hands out its expired reports in batches and records which
+// were expired.
+type expiringReports struct {
+	pending []store.Report
+	expired []uuid.UUID
+	// gone are reports another replica expired in the meantime
+	gone map[uuid.UUID]bool
+}
+
+func (r *expiringReports) ExpiredOutputs(_ context.Context, _ time.Duration, _ map[string]time.Duration, limit int) ([]store.Report, error) {
+	batch := r.pending[:min(limit, len(r.pending))]
+	return append([]store.Report(nil), batch...), nil
+}
+
+func (r *expiringReports) ExpireReport(_ context.Context, _, reportID uuid.UUID) (*store.Report, error) {
+	for i, report := range r.pending {
+		if report.ID == reportID {
+			r.pending = append(r.pending[:i], r.pending[i+1:]...)
+			break
+		}
+	}
+	if r.gone[reportID] {
+		return nil, fmt.Errorf("failed to expire report %s: %w", reportID, sql.ErrNoRows)
+	}
+	r.expired = append(r.expired, reportID)
+	return &store.Report{ID: reportID}, nil
+}
+
+type idempotencyKeys struct {
+	deletedBefore time.Time
+}
+
+func (k *idempotencyKeys) DeleteCreatedBefore(_ context.Context, before time.Time) (int64, error) {
+	k.deletedBefore = before
+	return 3, nil
+}
+
+func reportWithOutput(key string) store.Report {
+	return store.Report{ID: uuid.New(), UserID: uuid.New(), OutputFilePath: &key}
+}
+
+func janitorMetric(name string) int64 {
+	metric := expvar.Get("report_janitor").(*expvar.Map).Get(name)
+	if metric == nil {
+		return 0
+	}
+	return metric.(*expvar.Int).Value()
+}
+
+func TestJanitorPurgesExpiredOutputs(t *testing.T) {
+	blob := &memoryBlob{objects: map[string][]byte{
+		"a":    []byte("12345"),
+		"b":    []byte("123"),
+		"c":    []byte("1"),
+		"kept": []byte("12"),
+	}}
+	missing := reportWithOutput("missing")
+	reports := &expiringReports{pending: []store.Report{
+		reportWithOutput("a"), reportWithOutput("b"), reportWithOutput("c"), missing,
+	}}
+	keys := &idempotencyKeys{}
+	janitor := worker.NewJanitor(&config.Config{JanitorBatchSize: 2, IdempotencyKeyTTL: time.Hour},
+		slog.New(slog.NewTextHandler(io.Discard, nil)), reports, keys, blob)
+	expiredBefore, bytesBefore, keysBefore := janitorMetric("reports_expired"), janitorMetric("bytes_purged"), janitorMetric("idempotency_keys_deleted")
+
+	janitor.Purge(context.Background())
+
+	// all batches are purged, outputs already gone from storage only expire the report
+	require.Len(t, reports.expired, 4)
+	require.Contains(t, reports.expired, missing.ID)
+	require.Empty(t, reports.pending)
+	require.Equal(t, map[string][]byte{"kept": []byte("12")}, blob.objects)
+	require.WithinDuration(t, time.Now().Add(-time.Hour), keys.deletedBefore, time.Minute)
+
+	require.Equal(t, int64(4), janitorMetric("reports_expired")-expiredBefore)
+	require.Equal(t, int64(9), janitorMetric("bytes_purged")-bytesBefore)
+	require.Equal(t, int64(3), janitorMetric("idempotency_keys_deleted")-keysBefore)
+}
+
+func TestJanitorKeepsReportsWhoseOutputCannotBeDeleted(t *testing.T) {
+	blob := &memoryBlob{objects: map[string][]byte{"a": []byte("12345"), "b": []byte("123")}, failOnKey: "a"}
+	failing := reportWithOutput("a")
+	gone := reportWithOutput("b")
+	reports := &expiringReports{pending: []store.Report{failing, gone}, gone: map[uuid.UUID]bool{gone.ID: true}}
+	janitor := worker.NewJanitor(&config.Config{JanitorBatchSize: 10},
+		slog.New(slog.NewTextHandler(io.Discard, nil)), reports, &idempotencyKeys{}, blob)
+	errorsBefore, expiredBefore := janitorMetric("errors"), janitorMetric("reports_expired")
+
+	janitor.Purge(context.Background())
+
+	// the failed report stays to be retried by the next run
+	require.Equal(t, []store.Report{failing}, reports.pending)
+	require.Empty(t, reports.expired)
+	require.Contains(t, blob.objects, "a")
+	require.Equal(t, int64(1), janitorMetric("errors")-errorsBefore)
+	// a report another replica expired counts as expired without bytes
+	require.Equal(t, int64(1), janitorMetric("reports_expired")-expiredBefore)
+}
@@ -0,0 +1,368 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/astroniumm/go-asyncapi/config"
+	"github.com/astroniumm/go-asyncapi/report"
+	"github.com/astroniumm/go-asyncapi/store"
+	"github.com/google/uuid"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Processor produces the output of a single claimed report.
+type Processor interface {
+	Process(ctx context.Context, report *store.Report) error
+}
+
+type ProcessorFunc func(ctx context.Context, report *store.Report) error
+
+func (f ProcessorFunc) Process(ctx context.Context, report *store.Report) error {
+	return f(ctx, report)
+}
+
+// ErrReportCancelled is the cancellation cause of reports cancelled by their owner.
+var ErrReportCancelled = errors.New("report was cancelled")
+
+// ErrLeaseLost is the cancellation cause of reports whose lease expired before it
+// could be renewed. The reaper has returned them to the queue already, so
+// whatever the worker produced for them is dropped.
+var ErrLeaseLost = errors.New("report lease was lost")
+
+type Pool struct {
+	config    *config.Config
+	logger    *slog.Logger
+	reports   *store.ReportsStore
+	processor Processor
+	fairShare *FairShare
+	// owner identifies this pool in the leases of the reports it claims
+	owner string
+
+	mu      sync.Mutex
+	running map[uuid.UUID]context.CancelCauseFunc
+
+	wake chan struct{}
+}
+
+func NewPool(config *config.Config, logger *slog.Logger, reports *store.ReportsStore, processor Processor) *Pool {
+	return &Pool{
+		config:    config,
+		logger:    logger,
+		reports:   reports,
+		processor: processor,
+		fairShare: NewFairShare(config),
+		owner:     leaseOwner(),
+		running:   map[uuid.UUID]context.CancelCauseFunc{},
+		wake:      make(chan struct{}, max(config.WorkerConcurrency, 1)),
+	}
+}
+
+// Wake makes idle workers look for pending reports right away instead of
+// waiting for the next poll.
+func (p *Pool) Wake() {
+	for i := 0; i < cap(p.wake); i++ {
+		select {
+		case p.wake <- struct{}{}:
+		default:
+			return
+		}
+	}
+}
+
+// Run claims and processes pending reports until ctx is cancelled. Reports that are
+// still running on shutdown get WorkerShutdownTimeout to finish before they are
+// cancelled and put back into the queue.
+func (p *Pool) Run(ctx context.Context) error {
+	concurrency := max(p.config.WorkerConcurrency, 1)
+
+	jobCtx, cancelJobs := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelJobs()
+
+	// keeps watching and renewing leases while running reports drain after shutdown
+	go p.watchCancellations(jobCtx)
+	go p.heartbeat(jobCtx)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.loop(ctx, jobCtx)
+		}()
+	}
+	p.logger.Info("report workers are running", "concurrency", concurrency)
+
+	<-ctx.Done()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(p.config.WorkerShutdownTimeout):
+		p.logger.Warn("report workers did not finish in time, cancelling running reports")
+		cancelJobs()
+		<-done
+	}
+
+	return nil
+}
+
+func (p *Pool) loop(ctx, jobCtx context.Context) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		report, err := p.reports.ClaimNext(ctx, p.owner, p.config.WorkerLeaseDuration, time.Now().Add(-p.config.ReportFairShareWindow), p.fairShare.Order)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) && ctx.Err() == nil {
+				p.logger.Error("failed to claim report", "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-p.wake:
+			case <-time.After(p.config.WorkerPollInterval):
+			}
+			continue
+		}
+
+		p.execute(jobCtx, report)
+	}
+}
+
+func (p *Pool) execute(ctx context.Context, report *store.Report) {
+	logger := p.logger.With("report_id", report.ID, "user_id", report.UserID)
+	logger.Info("report started")
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	p.track(report.ID, cancel)
+	defer p.untrack(report.ID)
+
+	err := p.process(ctx, report)
+
+	// the outcome must be recorded even if the job context has been cancelled
+	recordCtx, cancelRecord := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancelRecord()
+
+	switch {
+	case errors.Is(context.Cause(ctx), ErrReportCancelled):
+		logger.Info("running report cancelled")
+	case errors.Is(context.Cause(ctx), ErrLeaseLost) || errors.Is(err, ErrLeaseLost):
+		logger.Warn("report lease expired while running, the report was returned to the queue")
+	case err == nil:
+		if _, err := p.reports.CompleteReport(recordCtx, report.UserID, report.ID, p.owner); err != nil {
+			if p.dropped(logger, err) {
+				return
+			}
+			logger.Error("failed to record report completion", "error", err)
+			return
+		}
+		logger.Info("report completed")
+	case ctx.Err() != nil:
+		if err := p.reports.ReleaseReport(recordCtx, report.UserID, report.ID, p.owner); err != nil {
+			logger.Error("failed to release interrupted report", "error", err)
+			return
+		}
+		logger.Warn("report interrupted by shutdown and returned to the queue")
+	default:
+		p.recordFailure(recordCtx, logger, report, err)
+	}
+}
+
+// recordFailure schedules another attempt with backoff, or moves the report into a
+// terminal state when the error is permanent or the attempts are exhausted.
+func (p *Pool) recordFailure(ctx context.Context, logger *slog.Logger, r *store.Report, cause error) {
+	policy := RetryPolicyFor(p.config, r.ReportType)
+
+	switch {
+	case report.IsPermanent(cause):
+		if _, err := p.reports.FailReport(ctx, r.UserID, r.ID, p.owner, cause.Error()); err != nil {
+			if p.dropped(logger, err) {
+				return
+			}
+			logger.Error("failed to record report failure", "error", err)
+			return
+		}
+		logger.Error("report failed permanently", "error", cause, "attempt", r.Attempts)
+	case policy.CanRetry(r.Attempts):
+		nextAttemptAt := time.Now().Add(policy.Delay(r.Attempts))
+		if _, err := p.reports.RetryReport(ctx, r.UserID, r.ID, p.owner, cause.Error(), nextAttemptAt); err != nil {
+			if p.dropped(logger, err) {
+				return
+			}
+			logger.Error("failed to schedule report retry", "error", err)
+			return
+		}
+		logger.Warn("report failed, retry scheduled", "error", cause, "attempt", r.Attempts, "next_attempt_at", nextAttemptAt)
+	default:
+		if _, err := p.reports.DeadLetterReport(ctx, r.UserID, r.ID, p.owner, cause.Error()); err != nil {
+			if p.dropped(logger, err) {
+				return
+			}
+			logger.Error("failed to dead-letter report", "error", err)
+			return
+		}
+		logger.Error("report ran out of attempts and was dead-lettered", "error", cause, "attempt", r.Attempts)
+	}
+}
+
+// dropped reports whether the outcome of a report could not be recorded because
+// the report is no longer held by this pool. It was cancelled, or it lost its
+// lease and was returned to the queue, possibly claimed by another worker, so
+// the outcome is dropped as if the lease had been lost while running.
+func (p *Pool) dropped(logger *slog.Logger, err error) bool {
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false
+	}
+	logger.Warn("report is no longer leased to this worker, the outcome was dropped", "error", ErrLeaseLost)
+	return true
+}
+
+func (p *Pool) track(reportID uuid.UUID, cancel context.CancelCauseFunc) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running[reportID] = cancel
+}
+
+func (p *Pool) untrack(reportID uuid.UUID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.running, reportID)
+}
+
+// CancelRunning cancels the context of the report if this pool is running it.
+func (p *Pool) CancelRunning(reportID uuid.UUID) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cancel, ok := p.running[reportID]
+	if ok {
+		cancel(ErrReportCancelled)
+	}
+	return ok
+}
+
+// watchCancellations periodically checks whether any report running in this
+// pool was cancelled, possibly through the API of another process. It backs up
+// the cancellation notifications, which are lost while the listener reconnects.
+func (p *Pool) watchCancellations(ctx context.Context) {
+	ticker := time.NewTicker(p.config.WorkerCancelPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		p.mu.Lock()
+		ids := make([]uuid.UUID, 0, len(p.running))
+		for id := range p.running {
+			ids = append(ids, id)
+		}
+		p.mu.Unlock()
+		if len(ids) == 0 {
+			continue
+		}
+
+		cancelled, err := p.reports.CancelledAmong(ctx, ids)
+		if err != nil {
+			if ctx.Err() == nil {
+				p.logger.Error("failed to check running reports for cancellation", "error", err)
+			}
+			continue
+		}
+		for _, id := range cancelled {
+			p.CancelRunning(id)
+		}
+	}
+}
+
+// heartbeat renews the leases of the reports running in this pool and stops
+// the ones whose lease was lost, e.g. after the database was unreachable for
+// longer than the lease.
+func (p *Pool) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(p.config.WorkerHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		p.mu.Lock()
+		ids := make([]uuid.UUID, 0, len(p.running))
+		for id := range p.running {
+			ids = append(ids, id)
+		}
+		p.mu.Unlock()
+		if len(ids) == 0 {
+			continue
+		}
+
+		renewed, err := p.reports.RenewLeases(ctx, p.owner, ids, p.config.WorkerLeaseDuration)
+		if err != nil {
+			if ctx.Err() == nil {
+				p.logger.Error("failed to renew report leases", "error", err)
+			}
+			continue
+		}
+
+		held := make(map[uuid.UUID]struct{}, len(renewed))
+		for _, id := range renewed {
+			held[id] = struct{}{}
+		}
+		p.mu.Lock()
+		for _, id := range ids {
+			// reports that finished since they were listed are no longer tracked
+			if cancel, ok := p.running[id]; ok {
+				if _, ok := held[id]; !ok {
+					cancel(ErrLeaseLost)
+				}
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+// leaseHolder is the owner of the lease r was claimed with.
+func leaseHolder(r *store.Report) string {
+	if r.LeaseOwner == nil {
+		return ""
+	}
+	return *r.LeaseOwner
+}
+
+// leaseOwner names this process in report leases.
+func leaseOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), uuid.NewString()[:8])
+}
+
+func (p *Pool) process(ctx context.Context, report *store.Report) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("report processor panicked: %v", r)
+		}
+	}()
+
+	return p.processor.Process(ctx, report)
+}
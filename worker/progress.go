@@ -0,0 +1,120 @@
+package worker
+
+import (
+	"context"
+	"github.com/astroniumm/go-asyncapi/report"
+	"github.com/astroniumm/go-asyncapi/store"
+	"log/slog"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxProgressStageLength matches the progress_stage column.
+const maxProgressStageLength = 100
+
+// ProgressStore is where a ProgressTracker saves progress.
+type ProgressStore interface {
+	SetProgress(ctx context.Context, owner string, progress store.ReportProgress) error
+}
+
+// ProgressTracker is the report.ProgressReporter handed to generators. It saves
+// the latest progress at most once every interval, Flush saves what is left.
+// Saves run in the background so generators are not held up by the database,
+// a snapshot taken while another is being saved replaces any snapshot still
+// waiting. Progress is best effort, failing to save it does not fail the report.
+type ProgressTracker struct {
+	ctx      context.Context
+	logger   *slog.Logger
+	progress ProgressStore
+	report   *store.Report
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending *report.Progress
+	savedAt time.Time
+	// queued waits for the goroutine that is saving, if saving is set
+	queued *store.ReportProgress
+	saving bool
+	idle   *sync.Cond
+}
+
+func NewProgressTracker(ctx context.Context, logger *slog.Logger, progress ProgressStore, r *store.Report, interval time.Duration) *ProgressTracker {
+	t := &ProgressTracker{
+		ctx:      ctx,
+		logger:   logger,
+		progress: progress,
+		report:   r,
+		interval: interval,
+	}
+	t.idle = sync.NewCond(&t.mu)
+	return t
+}
+
+func (t *ProgressTracker) Report(progress report.Progress) {
+	progress.Percent = min(max(progress.Percent, 0), 100)
+	progress.RowsProcessed = max(progress.RowsProcessed, 0)
+	if utf8.RuneCountInString(progress.Stage) > maxProgressStageLength {
+		progress.Stage = string([]rune(progress.Stage)[:maxProgressStageLength])
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending = &progress
+	if time.Since(t.savedAt) >= t.interval {
+		t.enqueue()
+	}
+}
+
+// Flush saves progress that was held back by the interval and waits until all
+// progress has been saved.
+func (t *ProgressTracker) Flush() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pending != nil {
+		t.enqueue()
+	}
+	for t.saving {
+		t.idle.Wait()
+	}
+}
+
+// enqueue hands the pending progress to the saving goroutine, starting it if
+// it is not running. t.mu must be held.
+func (t *ProgressTracker) enqueue() {
+	now := time.Now()
+	t.queued = &store.ReportProgress{
+		UserID:        t.report.UserID,
+		ReportID:      t.report.ID,
+		Percent:       t.pending.Percent,
+		Stage:         t.pending.Stage,
+		RowsProcessed: t.pending.RowsProcessed,
+		UpdatedAt:     now,
+	}
+	t.pending = nil
+	t.savedAt = now
+	if !t.saving {
+		t.saving = true
+		go t.drain()
+	}
+}
+
+// drain saves queued snapshots, one at a time and in order, until none is left.
+func (t *ProgressTracker) drain() {
+	for {
+		t.mu.Lock()
+		snapshot := t.queued
+		t.queued = nil
+		if snapshot == nil {
+			t.saving = false
+			t.idle.Broadcast()
+			t.mu.Unlock()
+			return
+		}
+		t.mu.Unlock()
+
+		if err := t.progress.SetProgress(t.ctx, leaseHolder(t.report), *snapshot); err != nil && t.ctx.Err() == nil {
+			t.logger.Warn("failed to save report progress", "error", err, "report_id", snapshot.ReportID)
+		}
+	}
+}
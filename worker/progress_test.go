@@ -0,0 +1,140 @@
+package worker_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/astroniumm/go-asyncapi/report"
+	"github.com/astroniumm/go-asyncapi/store"
+	"github.com/astroniumm/go-asyncapi/worker"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// progressStore records saved progress. If block is set, saves announce
+// themselves on started and wait for block to be closed.
+type progressStore struct {
+	mu      sync.Mutex
+	saved   []store.ReportProgress
+	owners  []string
+	err     error
+	started chan struct{}
+	block   chan struct{}
+}
+
+func (s *progressStore) SetProgress(ctx context.Context, owner string, progress store.ReportProgress) error {
+	if s.block != nil {
+		s.started <- struct{}{}
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.saved = append(s.saved, progress)
+	s.owners = append(s.owners, owner)
+	return nil
+}
+
+func (s *progressStore) all() []store.ReportProgress {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]store.ReportProgress(nil), s.saved...)
+}
+
+func TestProgressTrackerThrottles(t *testing.T) {
+	saved := &progressStore{}
+	owner := "worker-1"
+	r := &store.Report{UserID: uuid.New(), ID: uuid.New(), LeaseOwner: &owner}
+	tracker := worker.NewProgressTracker(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)), saved, r, time.Hour)
+
+	tracker.Report(report.Progress{Stage: "querying"})
+	for i := 1; i <= 100; i++ {
+		tracker.Report(report.Progress{Stage: "writing", Percent: float64(i), RowsProcessed: int64(i)})
+	}
+
+	// the first update is saved right away, the rest waits for the interval
+	require.Eventually(t, func() bool { return len(saved.all()) == 1 }, time.Second, time.Millisecond)
+	first := saved.all()[0]
+	require.Equal(t, "querying", first.Stage)
+	require.Equal(t, r.UserID, first.UserID)
+	require.Equal(t, r.ID, first.ReportID)
+
+	tracker.Flush()
+	all := saved.all()
+	require.Len(t, all, 2)
+	require.Equal(t, "writing", all[1].Stage)
+	require.Equal(t, 100.0, all[1].Percent)
+	require.EqualValues(t, 100, all[1].RowsProcessed)
+	// progress is only saved while the report is leased to its worker
+	require.Equal(t, []string{owner, owner}, saved.owners)
+
+	// nothing left to flush
+	tracker.Flush()
+	require.Len(t, saved.all(), 2)
+}
+
+func TestProgressTrackerSanitizes(t *testing.T) {
+	saved := &progressStore{}
+	tracker := worker.NewProgressTracker(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)), saved, &store.Report{}, 0)
+
+	tracker.Report(report.Progress{Percent: 250, RowsProcessed: -1, Stage: strings.Repeat("é", 300)})
+	tracker.Flush()
+	tracker.Report(report.Progress{Percent: -5})
+	tracker.Flush()
+
+	all := saved.all()
+	require.Len(t, all, 2)
+	require.Equal(t, 100.0, all[0].Percent)
+	require.EqualValues(t, 0, all[0].RowsProcessed)
+	require.Equal(t, strings.Repeat("é", 100), all[0].Stage)
+	require.Equal(t, 0.0, all[1].Percent)
+}
+
+func TestProgressTrackerDoesNotWaitForSaves(t *testing.T) {
+	saved := &progressStore{started: make(chan struct{}, 2), block: make(chan struct{})}
+	tracker := worker.NewProgressTracker(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)), saved, &store.Report{}, 0)
+
+	tracker.Report(report.Progress{Stage: "querying"})
+	<-saved.started
+
+	reported := make(chan struct{})
+	go func() {
+		defer close(reported)
+		tracker.Report(report.Progress{Stage: "writing"})
+		tracker.Report(report.Progress{Stage: "uploading"})
+	}()
+	select {
+	case <-reported:
+	case <-time.After(time.Second):
+		t.Fatal("reporting progress waited for the database")
+	}
+
+	// snapshots taken while a save is running replace each other, the latest is saved
+	close(saved.block)
+	tracker.Flush()
+	all := saved.all()
+	require.Len(t, all, 2)
+	require.Equal(t, "querying", all[0].Stage)
+	require.Equal(t, "uploading", all[1].Stage)
+}
+
+func TestProgressTrackerLogsFailedSaves(t *testing.T) {
+	var logs bytes.Buffer
+	saved := &progressStore{err: errors.New("connection refused")}
+	tracker := worker.NewProgressTracker(context.Background(), slog.New(slog.NewTextHandler(&logs, nil)), saved, &store.Report{}, 0)
+
+	tracker.Report(report.Progress{Stage: "querying"})
+	tracker.Flush()
+
+	require.Empty(t, saved.all())
+	require.Contains(t, logs.String(), "failed to save report progress")
+	require.Contains(t, logs.String(), "connection refused")
+}
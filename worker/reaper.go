@@ -0,0 +1,104 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/astroniumm/go-asyncapi/config"
+	"github.com/astroniumm/go-asyncapi/store"
+	"log/slog"
+	"time"
+)
+
+const reaperBatchSize = 100
+
+// errLeaseExpired is recorded on reports recovered by the reaper.
+var errLeaseExpired = errors.New("worker stopped renewing the report lease, it probably crashed")
+
+// Reaper recovers reports whose worker died without finishing them, e.g. after
+// SIGKILL or OOM. Their lease is no longer renewed, so once it expires they are
+// returned to the queue. The attempt they were claimed with counts, reports
+// that keep killing their workers end up dead-lettered.
+type Reaper struct {
+	config  *config.Config
+	logger  *slog.Logger
+	reports *store.ReportsStore
+}
+
+func NewReaper(config *config.Config, logger *slog.Logger, reports *store.ReportsStore) *Reaper {
+	return &Reaper{
+		config:  config,
+		logger:  logger,
+		reports: reports,
+	}
+}
+
+// Run recovers reports with expired leases every ReaperInterval until ctx is cancelled.
+func (r *Reaper) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.config.ReaperInterval)
+	defer ticker.Stop()
+
+	for {
+		r.reap(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Reaper) reap(ctx context.Context) {
+	for ctx.Err() == nil {
+		reports, err := r.reports.ExpiredLeases(ctx, reaperBatchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				r.logger.Error("failed to list reports with expired leases", "error", err)
+			}
+			return
+		}
+
+		recovered := 0
+		for i := range reports {
+			if r.recover(ctx, &reports[i]) {
+				recovered++
+			}
+		}
+
+		// a batch that could not be recovered would be listed again right away
+		if len(reports) < reaperBatchSize || recovered == 0 {
+			return
+		}
+	}
+}
+
+func (r *Reaper) recover(ctx context.Context, report *store.Report) bool {
+	logger := r.logger.With("report_id", report.ID, "user_id", report.UserID, "attempt", report.Attempts)
+	if report.LeaseOwner != nil {
+		logger = logger.With("lease_owner", *report.LeaseOwner)
+	}
+
+	var nextAttemptAt *time.Time
+	policy := RetryPolicyFor(r.config, report.ReportType)
+	if policy.CanRetry(report.Attempts) {
+		at := time.Now().Add(policy.Delay(report.Attempts))
+		nextAttemptAt = &at
+	}
+
+	if _, err := r.reports.RecoverExpiredLease(ctx, report.UserID, report.ID, errLeaseExpired.Error(), nextAttemptAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// renewed or finished in the meantime
+			return true
+		}
+		logger.Error("failed to recover report with expired lease", "error", err)
+		return false
+	}
+
+	if nextAttemptAt == nil {
+		logger.Error("report with expired lease ran out of attempts and was dead-lettered")
+	} else {
+		logger.Warn("report with expired lease returned to the queue", "next_attempt_at", *nextAttemptAt)
+	}
+	return true
+}
@@ -0,0 +1,25 @@
+package worker
+
+import (
+	"github.com/astroniumm/go-asyncapi/config"
+	"github.com/astroniumm/go-asyncapi/retry"
+)
+
+// RetryPolicyFor returns the retry policy of a report type: the configured
+// defaults, overridden by REPORT_MAX_ATTEMPTS_BY_TYPE and REPORT_RETRY_BACKOFF_BY_TYPE
+// entries such as "signups:5" and "signups:1m".
+func RetryPolicyFor(config *config.Config, reportType string) retry.Policy {
+	policy := retry.Policy{
+		MaxAttempts: config.ReportMaxAttempts,
+		Backoff:     config.ReportRetryBackoff,
+		MaxBackoff:  config.ReportRetryMaxBackoff,
+	}
+	if maxAttempts, ok := config.ReportMaxAttemptsByType[reportType]; ok {
+		policy.MaxAttempts = maxAttempts
+	}
+	if backoff, ok := config.ReportRetryBackoffByType[reportType]; ok {
+		policy.Backoff = backoff
+	}
+
+	return policy
+}
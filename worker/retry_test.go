@@ -0,0 +1,36 @@
+package worker_test
+
+import (
+	"github.com/astroniumm/go-asyncapi/config"
+	"github.com/astroniumm/go-asyncapi/worker"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	conf := &config.Config{
+		ReportMaxAttempts:        3,
+		ReportRetryBackoff:       30 * time.Second,
+		ReportRetryMaxBackoff:    5 * time.Minute,
+		ReportMaxAttemptsByType:  map[string]int{"signups": 5},
+		ReportRetryBackoffByType: map[string]time.Duration{"signups": time.Minute},
+	}
+
+	policy := worker.RetryPolicyFor(conf, "orders")
+	require.Equal(t, 3, policy.MaxAttempts)
+	require.Equal(t, 30*time.Second, policy.Delay(1))
+	require.Equal(t, time.Minute, policy.Delay(2))
+	require.Equal(t, 2*time.Minute, policy.Delay(3))
+	require.Equal(t, 5*time.Minute, policy.Delay(5))
+	require.Equal(t, 5*time.Minute, policy.Delay(1000))
+	require.True(t, policy.CanRetry(2))
+	require.False(t, policy.CanRetry(3))
+
+	policy = worker.RetryPolicyFor(conf, "signups")
+	require.Equal(t, 5, policy.MaxAttempts)
+	require.Equal(t, time.Minute, policy.Delay(1))
+	require.Equal(t, 4*time.Minute, policy.Delay(3))
+	require.True(t, policy.CanRetry(4))
+	require.False(t, policy.CanRetry(5))
+}